@@ -0,0 +1,41 @@
+;;; ****************************************************************************
+;;; Tests for the multiplication and division routines, run them with:
+;;;
+;;;   $ xbbasm test examples/005_mult_and_div_test.asm
+;;;
+;;; ****************************************************************************
+
+./include 005_mult_and_div.asm
+
+.test multiply_7_by_9
+	.set multiplier = 7
+	.set multiplicand = 9
+	.call multiply
+	.expect prodlo = 63
+	.expect prodhi = 0
+.end
+
+.test multiply_15_bit_result
+	.set multiplier = 200
+	.set multiplicand = 120
+	.call multiply
+	.expect prodlo = [<b 24000]
+	.expect prodhi = [>b 24000]
+.end
+
+.test multiply_by_zero
+	.set multiplier = 0
+	.set multiplicand = 99
+	.call multiply
+	.expect prodlo = 0
+	.expect prodhi = 0
+	.expect z = 1
+.end
+
+.test divide_100_by_7
+	.set dividend = 100
+	.set divisor = 7
+	.call divide
+	.expect quotient = 14
+	.expect a = 2
+.end
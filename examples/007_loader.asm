@@ -18,6 +18,7 @@ second_part:
 ;; First part:
 
 	.org $c000
+main:
 	jmp second_part
 
 ;; *****************************************************************************
@@ -26,8 +27,7 @@ second_part:
 
 	.org $0801
 
-	dfb $0d,$08,$d9,$07,$9e,$20,$34,$39
-	dfb $31,$35,$32,$00,$00,$00
+	.basic_sys main, 2009
 ;; *****************************************************************************
 
 ;; Third part:
@@ -1,7 +1,6 @@
 ; load sid music
 
 .org address_music                         ; address to load the music data
-./bin ../resources/jeff_donald.sid         ; header from sid and original loading address have been 
-                                           ; manually cut off since xbbasm does not currently support
-                                           ; binary include parameters
+./bin ../resources/jeff_donald.sid         ; header from sid and original loading address have been
+                                           ; cut off already, a whole sid would need skip=$7e
 
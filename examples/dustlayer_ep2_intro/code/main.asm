@@ -2,6 +2,7 @@
 ;    some initialization and interrupt redirect setup
 ;============================================================
 
+main:
            sei                 ; set interrupt disable flag
             
            jsr init_screen     ; clear the screen
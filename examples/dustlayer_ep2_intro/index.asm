@@ -18,8 +18,7 @@
 ;============================================================
 
 .org $0801                            ; BASIC start address (#2049)
-dfb $0d,$08,$dc,$07,$9e,$20,$34,$39   ; BASIC loader to start at $c000...
-dfb $31,$35,$32,$00,$00,$00           ; puts BASIC line 2012 SYS 49152
+.basic_sys main, 2012                ; BASIC line 2012 SYS 49152
 .org $c000                            ; start address for 6502 code
 
 ;============================================================
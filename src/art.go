@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Sprites and characters drawn in the sources, a row of pixels per line:
+//
+//	ball	.char
+//		..####..
+//		.######.
+//		########
+//		########
+//		########
+//		########
+//		.######.
+//		..####..
+//	.end
+//
+// In hires `.` is a clear pixel and `#` a set one. With `.sprite
+// multicolor` or `.char multicolor` each character is a double wide
+// pixel, `.` for the background and `1`, `2` and `3` for the bit pairs
+// 01, 10 and 11. Sprites are 24x21 pixels (12 wide in multicolor) and
+// padded to 64 bytes like the ones from images, characters are 8x8 (4
+// wide in multicolor).
+
+// artBlock keeps the rows of a .sprite or .char block until its .end
+type artBlock struct {
+	line tokenizedLine
+	rows []string
+	locs []sourceLocation
+}
+
+// isArtBlock tells if the directive starts
+// a block of rows drawn in the sources
+func isArtBlock(mnemonic string) bool {
+	return mnemonic == ".SPRITE" || mnemonic == ".CHAR"
+}
+
+// pack turns the rows into bytes, returning the
+// line with them once the block is closed at loc
+func (b *artBlock) pack(loc sourceLocation) (*tokenizedLine, error) {
+	width, height, what := spriteWidth, spriteHeight, "sprite"
+	if b.line.opc.mnemonic == ".CHAR" {
+		width, height, what = cellSize, cellSize, "character"
+	}
+	multicolor := b.line.opr.args[0] == "multicolor"
+	bits := bitsPerPixel(multicolor)
+
+	if len(b.rows) != height {
+		return nil, fmt.Errorf("%s:%d:A %s has %d rows, found %d", loc.file, loc.line, what, height, len(b.rows))
+	}
+
+	data := []byte{}
+	for i, row := range b.rows {
+		at := fmt.Sprintf("%s:%d", b.locs[i].file, b.locs[i].line)
+		if len(row) != width/bits {
+			return nil, fmt.Errorf("%s:A %s row has %d pixels, found %d", at, what, width/bits, len(row))
+		}
+
+		var v byte
+		for x := 0; x < len(row); x++ {
+			pixel, valid := artPixel(row[x], multicolor)
+			if !valid {
+				return nil, fmt.Errorf("%s:Invalid pixel %c in %s", at, row[x], row)
+			}
+			v = v<<uint(bits) | pixel
+			if (x+1)*bits%8 == 0 {
+				data = append(data, v)
+				v = 0
+			}
+		}
+	}
+	if what == "sprite" {
+		data = append(data, make([]byte, spriteBlock-spriteBytes)...)
+	}
+
+	line := b.line
+	line.opr.defBytes = data
+	return &line, nil
+}
+
+// artPixel reads the value of a pixel of a row
+func artPixel(c byte, multicolor bool) (byte, bool) {
+	switch {
+	case c == '.':
+		return 0, true
+	case !multicolor && c == '#':
+		return 1, true
+	case multicolor && c >= '1' && c <= '3':
+		return c - '0', true
+	}
+	return 0, false
+}
+
+// isArtBlockEnd tells if the line closes a .sprite or .char block
+func isArtBlockEnd(l string) bool {
+	return strings.ToUpper(l) == ".END"
+}
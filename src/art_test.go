@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestArtBlocks(t *testing.T) {
+	defer resetSymbols()
+
+	rows := func(n int, row string) []string {
+		lines := []string{}
+		for i := 0; i < n; i++ {
+			lines = append(lines, "\t"+row)
+		}
+		return lines
+	}
+	block := func(start string, body []string) []string {
+		return append(append([]string{"\t.org $2000", start}, body...), ".end")
+	}
+
+	ball := []string{"..####..", ".######.", "########", "########", "########", "########", ".######.", "..####.."}
+	sprite := append([]string{"#......................#"}, rows(20, "........................")...)
+	multicolor := append([]string{".123........"}, rows(20, "............")...)
+
+	var tests = []struct {
+		lines    []string
+		expected []byte // first bytes of the program after the load address
+		size     int
+		err      string
+	}{
+		{block("ball .char", ball), []byte{0x3C, 0x7E, 0xFF, 0xFF, 0xFF, 0xFF, 0x7E, 0x3C}, 8, ""},
+		{block(".char multicolor", rows(8, "1.23")), []byte{0x4B, 0x4B}, 8, ""},
+		{block(".sprite", sprite), []byte{0x80, 0x00, 0x01, 0x00}, 64, ""},
+		{block("ship:\n.sprite multicolor", multicolor), []byte{0x1B, 0x00, 0x00}, 64, ""},
+		{block(".char", rows(7, "........")), nil, 0, ":10:A character has 8 rows, found 7"},
+		{block(".char", append(rows(7, "........"), "......")), nil, 0, ":10:A character row has 8 pixels, found 6"},
+		{block(".char multicolor", append(rows(7, "...."), "..#.")), nil, 0, ":10:Invalid pixel # in ..#."},
+		{[]string{"\t.org $2000", ".sprite", "\t........................"}, nil, 0, ":2:Missing .end for .sprite block"},
+	}
+
+	for i, test := range tests {
+		asm, err := assembleLines(t, test.lines)
+		if test.err != "" {
+			if err == nil || !strings.HasSuffix(err.Error(), test.err) {
+				t.Errorf("test %d: expected error %s but got %v", i, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: unexpected error %s", i, err.Error())
+		} else if len(asm.program) != 2+test.size || !bytes.HasPrefix(asm.program[2:], test.expected) {
+			t.Errorf("test %d: expected %d bytes starting with % x but got % x", i, test.size, test.expected, asm.program[2:])
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Tests are written in the sources in blocks like:
+//
+//	.test multiply_7_by_9
+//		.set multiplier = 7
+//		.set multiplicand = 9
+//		.call multiply
+//		.expect prodlo = 63
+//		.expect c = 0
+//	.end
+//
+// With the KERNAL stand-ins `.expect output = "TEXT{return}"` also
+// checks everything printed since the test started, the text written
+// as for `.petscii` in the uppercase character set.
+//
+// The steps run in order on the simulator, each test starting
+// with the program freshly loaded. Tests don't take any space
+// in the program and are ignored when assembling it.
+
+type asmTest struct {
+	name  string
+	line  *tokenizedLine
+	steps []*tokenizedLine
+}
+
+// isTestStep tells if the directive is one of the steps of a test
+func isTestStep(mnemonic string) bool {
+	return mnemonic == ".SET" || mnemonic == ".CALL" || mnemonic == ".EXPECT"
+}
+
+// getValue reads a register (a, x, y, sp), a flag
+// (c, z, i, d, v, n) or a memory address
+func getValue(c *cpu, target string) (int, error) {
+	flags := map[string]byte{"c": flagC, "z": flagZ, "i": flagI, "d": flagD, "v": flagV, "n": flagN}
+
+	switch t := strings.ToLower(target); {
+	case t == "a":
+		return int(c.a), nil
+	case t == "x":
+		return int(c.x), nil
+	case t == "y":
+		return int(c.y), nil
+	case t == "sp":
+		return int(c.sp), nil
+	case flags[t] != 0:
+		if c.flag(flags[t]) {
+			return 1, nil
+		}
+		return 0, nil
+	}
+
+	addr, addrErr := resolveExpression(target)
+	if addrErr != nil {
+		return 0, addrErr
+	} else if addr < 0 || addr > 0xFFFF {
+		return 0, fmt.Errorf("Out of range address %s", target)
+	}
+	return int(c.read(addr)), nil
+}
+
+// runTest runs the steps of a test and returns the failed
+// expectations, or an error if the test couldn't run at all
+func runTest(asm *assembly, test asmTest, limit int, useKernal bool) ([]string, int, error) {
+
+	c := newCPU()
+	var k *kernal
+	if useKernal {
+		k = installKernal(c)
+	}
+	c.load(asm.program)
+	failures := []string{}
+
+	for _, step := range test.steps {
+		args := step.opr.args
+		at := fmt.Sprintf("%s:%d", step.loc.file, step.loc.line)
+
+		switch step.opc.mnemonic {
+		case ".SET":
+			value, err := resolveExpression(args[1])
+			if err == nil {
+				err = setValue(c, args[0], value)
+			}
+			if err != nil {
+				return nil, c.cycles, fmt.Errorf("%s: %s", at, err.Error())
+			}
+		case ".CALL":
+			addr, err := resolveExpression(args[0])
+			if err == nil {
+				_, err = runRoutine(c, addr, limit, nil)
+			}
+			if err != nil {
+				return nil, c.cycles, fmt.Errorf("%s: %s", at, err.Error())
+			}
+		case ".EXPECT":
+			if strings.ToLower(args[0]) == "output" {
+				failure, err := expectOutput(k, args[1])
+				if err != nil {
+					return nil, c.cycles, fmt.Errorf("%s: %s", at, err.Error())
+				} else if failure != "" {
+					failures = append(failures, fmt.Sprintf("%s: %s", at, failure))
+				}
+				continue
+			}
+			expected, err := resolveExpression(args[1])
+			if err != nil {
+				return nil, c.cycles, fmt.Errorf("%s: %s", at, err.Error())
+			} else if expected < 0 || expected > 0xFF {
+				return nil, c.cycles, fmt.Errorf("%s: Value $%x of %s doesn't fit in a byte", at, expected, args[1])
+			}
+			actual, err := getValue(c, args[0])
+			if err != nil {
+				return nil, c.cycles, fmt.Errorf("%s: %s", at, err.Error())
+			}
+			if actual != expected {
+				failures = append(
+					failures,
+					fmt.Sprintf("%s: %s: expected $%02x but got $%02x", at, args[0], expected, actual))
+			}
+		}
+	}
+	return failures, c.cycles, nil
+}
+
+// expectOutput compares what was printed with the KERNAL routines
+// to a quoted text, encoded as PETSCII like the text directives do
+func expectOutput(k *kernal, value string) (string, error) {
+	if k == nil {
+		return "", fmt.Errorf("Checking the output needs the KERNAL routines (-kernal)")
+	}
+	if end, endErr := scanString(value, 0); value[0] != '"' || endErr != nil || end != len(value) {
+		return "", fmt.Errorf("Syntax error in %s, expecting a quoted text", value)
+	}
+	e := newTextEncoder()
+	e.upper = true
+	expected, err := e.encode(".PETSCII", []byte(value[1:len(value)-1]))
+	if err != nil {
+		return "", err
+	}
+	if !bytes.Equal(k.console, expected) {
+		return fmt.Sprintf("output: expected %q but got %q", petsciiToText(expected), petsciiToText(k.console)), nil
+	}
+	return "", nil
+}
+
+// runTests runs the tests of a program matching the filter, writing the
+// results like `go test` does. It returns the number of tests run and failed.
+func runTests(asm *assembly, filter *regexp.Regexp, limit int, useKernal, verbose bool, out io.Writer) (int, int) {
+	run, failed := 0, 0
+	for _, test := range asm.tests {
+		if filter != nil && !filter.MatchString(test.name) {
+			continue
+		}
+		run++
+		if verbose {
+			fmt.Fprintf(out, "=== RUN   %s\n", test.name)
+		}
+
+		failures, cycles, err := runTest(asm, test, limit, useKernal)
+		if err != nil {
+			failures = append(failures, err.Error())
+		}
+
+		if len(failures) > 0 {
+			failed++
+			fmt.Fprintf(out, "--- FAIL: %s (%d cycles)\n", test.name, cycles)
+			for _, f := range failures {
+				fmt.Fprintf(out, "    %s\n", f)
+			}
+		} else if verbose {
+			fmt.Fprintf(out, "--- PASS: %s (%d cycles)\n", test.name, cycles)
+		}
+	}
+	return run, failed
+}
+
+// -----------------------------------------------------------------------------
+// Command:
+// -----------------------------------------------------------------------------
+
+// testMain runs `xbbasm test [options] file.asm...`
+func testMain(args []string) {
+
+	fs := flag.NewFlagSet("test", flag.ExitOnError)
+	run := fs.String("run", "", "only run the tests whose name matches the `regexp`")
+	limit := fs.Int("limit", defaultCycleLimit, "fail a call after running this many cycles")
+	verbose := fs.Bool("v", false, "verbose output, list all the tests run")
+	useKernal := fs.Bool("kernal", false, "do the KERNAL screen routines in Go, needed for `.expect output`")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fail("must specify input file")
+	}
+
+	var filter *regexp.Regexp
+	if *run != "" {
+		var err error
+		if filter, err = regexp.Compile(*run); err != nil {
+			fail(err.Error())
+		}
+	}
+
+	anyFailed := false
+	for _, input := range fs.Args() {
+		resetSymbols()
+		asm := assembleFile(input)
+		if asm.program == nil {
+			fail(errBanked.Error())
+		}
+
+		if run, failed := runTests(asm, filter, *limit, *useKernal, *verbose, os.Stdout); failed > 0 {
+			anyFailed = true
+			fmt.Printf("FAIL\t%s\t%d of %d tests failed\n", input, failed, run)
+		} else {
+			fmt.Printf("ok  \t%s\t%d tests\n", input, run)
+		}
+	}
+
+	if anyFailed {
+		fmt.Println("FAIL")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAsmTests(t *testing.T) {
+	defer resetSymbols()
+
+	asm := assembleTestFile(t, "../examples/005_mult_and_div_test.asm")
+	out := new(bytes.Buffer)
+	if run, failed := runTests(asm, nil, defaultCycleLimit, false, false, out); run != 4 || failed != 0 {
+		t.Errorf("expected 4 tests passing but %d of %d failed:\n%s", failed, run, out)
+	}
+
+	source := strings.Join([]string{
+		"\t.org $c000",
+		"double:\tasl a",
+		"\trts",
+		"forever:\tjmp forever",
+		".test double_fails",
+		"\t.set a = 3",
+		"\t.call double",
+		"\t.expect a = 7",
+		"\t.expect c = 0",
+		".end",
+		".test loops_forever",
+		"\t.call forever",
+		".end",
+	}, "\n")
+	filename := filepath.Join(t.TempDir(), "fail.asm")
+	if err := ioutil.WriteFile(filename, []byte(source), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	asm = assembleTestFile(t, filename)
+
+	out.Reset()
+	if run, failed := runTests(asm, nil, 1000, false, false, out); run != 2 || failed != 2 {
+		t.Errorf("expected 2 tests failing but %d of %d failed:\n%s", failed, run, out)
+	}
+	expected := "--- FAIL: double_fails (8 cycles)\n" +
+		"    " + filename + ":8: a: expected $07 but got $06\n"
+	if !strings.HasPrefix(out.String(), expected) {
+		t.Errorf("expected output to start with:\n%s\nbut got:\n%s", expected, out)
+	}
+}
+
+func TestExpectByteRange(t *testing.T) {
+	defer resetSymbols()
+
+	for _, test := range []struct {
+		line string
+		err  string
+	}{
+		{".expect a = $ff", ""},
+		{".expect $c000 = 0", ""},
+		{".expect a = big", ""},
+		{".expect a = 256", "Value 256 is out of range. Enter only values valid for a byte's range"},
+		{".expect $0400 = $100", "Value $100 is out of range. Enter only values valid for a byte's range"},
+		{".expect a = -1", "Value -1 is out of range. Enter only values valid for a byte's range"},
+		{".set a = 256", ""},
+	} {
+		_, err := tokenizer{}.tokenize(test.line)
+		if test.err == "" && err != nil {
+			t.Errorf("%s: unexpected error %s", test.line, err.Error())
+		} else if test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("%s: expected error %q but got %v", test.line, test.err, err)
+		}
+	}
+
+	// values of labels are only known when the test runs
+	source := strings.Join([]string{
+		"\t.org $c000",
+		"big = $100",
+		"zero:\tlda #0",
+		"\trts",
+		".test too_big",
+		"\t.call zero",
+		"\t.expect a = big",
+		".end",
+	}, "\n")
+	filename := filepath.Join(t.TempDir(), "range.asm")
+	if err := ioutil.WriteFile(filename, []byte(source), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	asm := assembleTestFile(t, filename)
+
+	out := new(bytes.Buffer)
+	if run, failed := runTests(asm, nil, 1000, false, false, out); run != 1 || failed != 1 {
+		t.Errorf("expected the test to fail but %d of %d failed:\n%s", failed, run, out)
+	}
+	if expected := filename + ":7: Value $100 of big doesn't fit in a byte\n"; !strings.HasSuffix(out.String(), expected) {
+		t.Errorf("expected output to end with:\n%s\nbut got:\n%s", expected, out)
+	}
+}
+
+func TestExpectOutput(t *testing.T) {
+	var tests = []struct {
+		console []byte
+		value   string
+		failure string
+		err     string
+	}{
+		{[]byte{0x93, 0x48, 0x49, 0x0D}, `"{clr}HI{return}"`, "", ""},
+		{[]byte{0x93, 0x48, 0x49, 0x0D}, `"{clr}hi{$0d}"`, "", ""},
+		{[]byte{0x22, 0x5C}, `"\"£"`, "", ""},
+		{[]byte{0x48}, `"HO"`, `output: expected "HO" but got "H"`, ""},
+		{[]byte{0x48}, `HI`, "", "Syntax error in HI, expecting a quoted text"},
+		{[]byte{0x48}, `"{bold}"`, "", "Unknown control code {bold}"},
+	}
+	for i, test := range tests {
+		c := newCPU()
+		k := installKernal(c)
+		k.console = test.console
+		failure, err := expectOutput(k, test.value)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("test %d: expected error %s but got %v", i, test.err, err)
+			}
+		} else if err != nil || failure != test.failure {
+			t.Errorf("test %d: expected %q but got %q (%v)", i, test.failure, failure, err)
+		}
+	}
+}
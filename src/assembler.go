@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
-	"io"
-	"os"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 type assemblyLine struct {
@@ -14,23 +16,106 @@ type assemblyLine struct {
 	skipOperand bool
 }
 
+// size returns the number of bytes taken by the line,
+// data lines have no opcode length but hold a single byte
+func (al assemblyLine) size() int {
+	if al.data.opc.len == 0 {
+		return 1
+	}
+	return al.data.opc.len
+}
+
 type segment struct {
 	partiallyAssembled []assemblyLine
+	bank               int
 }
 
-func assemble(programData []tokenizedLine) ([]byte, error) {
+// bankImage holds the segments of a bank and once
+// assembled the image from its lowest address
+type bankImage struct {
+	bank     int
+	start    int
+	segments []segment
+	image    []byte
+}
+
+// assembly is the outcome of assembling a program, it keeps
+// the layout of the program besides the bytes of the PRG so
+// it can be used for generating other outputs like debug info
+type assembly struct {
+	startAddr   int
+	segments    []segment
+	lines       []assemblyLine
+	program     []byte
+	banks       []bankImage
+	checkpoints []checkpoint
+	diskFiles   []diskFile
+	tests       []asmTest
+	messages    []message
+	tunes       []sidTune
+}
+
+func assemble(programData []tokenizedLine) (*assembly, error) {
 
 	var programSegments []segment
 	var currentSegment segment
+	var checkpoints []checkpoint
+	var diskFiles []diskFile
+	var tests []asmTest
+	var currentTest *asmTest
+	var diagnostics []*tokenizedLine
+	var tunes []sidTune
+	var blocks []codeBlock
+	var openBlocks []int
 	var p *tokenizedLine
 
 	startAddr := -1
 	currentAddr := -1
+	currentBank := 0
+	warnings := []message{}
+	encoder := newTextEncoder()
+
+	// setOrigin starts a new segment at the address
+	setOrigin := func(addr int) {
+		currentAddr = addr
+		// set start address for program
+		if startAddr == -1 {
+			startAddr = currentAddr
+		} else if startAddr > currentAddr {
+			startAddr = currentAddr
+		}
+		// append last segment to program if contains any data
+		if len(currentSegment.partiallyAssembled) > 0 {
+			programSegments = append(programSegments, currentSegment)
+		}
+		currentSegment = segment{partiallyAssembled: []assemblyLine{}, bank: currentBank}
+	}
 
 	// first pass
 	for i := 0; i < len(programData); i++ {
 		p = &programData[i]
 
+		// blocks have to be laid out as a whole
+		if (p.opc.mnemonic == ".ORG" || p.opc.mnemonic == ".BANK" || isBinWithOrigin(p)) && len(openBlocks) > 0 {
+			open := blocks[openBlocks[len(openBlocks)-1]].line
+			return nil, fmt.Errorf("%s:%d:%s inside the %s block at line %d", p.loc.file, p.loc.line,
+				strings.ToLower(p.opc.mnemonic), strings.ToLower(open.opc.mnemonic), open.loc.line)
+		}
+
+		// binary files are read before the labels since
+		// a PRG can set the origin with its load address
+		var binData []byte
+		if p.opc.mnemonic == "./BIN" {
+			data, loadAddr, binErr := readBinFile(p.opr)
+			if binErr != nil {
+				return nil, fmt.Errorf("Error when attempting to read %s : %s", p.opr.label, binErr)
+			}
+			if isBinWithOrigin(p) {
+				setOrigin(loadAddr)
+			}
+			binData = data
+		}
+
 		// labels
 		if p.label != "" {
 			if currentAddr < 0 {
@@ -49,22 +134,88 @@ func assemble(programData []tokenizedLine) ([]byte, error) {
 				if addr, lookupErr := lookupSymbol(p.opr.label); lookupErr != nil {
 					return nil, lookupErr
 				} else {
-					currentAddr = addr
+					setOrigin(addr)
 				}
 			} else {
-				currentAddr = p.opr.addr
-			}
-			// set start address for program
-			if startAddr == -1 {
-				startAddr = currentAddr
-			} else if startAddr > currentAddr {
-				startAddr = currentAddr
+				setOrigin(p.opr.addr)
 			}
-			// append last segment to program if contains any data
+			continue
+		}
+
+		// cartridge bank for the segments that follow
+		if p.opc.mnemonic == ".BANK" {
 			if len(currentSegment.partiallyAssembled) > 0 {
 				programSegments = append(programSegments, currentSegment)
 			}
-			currentSegment = segment{partiallyAssembled: []assemblyLine{}}
+			currentBank = p.opr.addr
+			currentSegment = segment{partiallyAssembled: []assemblyLine{}, bank: currentBank}
+			continue
+		}
+
+		// files for the disk image are
+		// not part of the program at all
+		if p.opc.mnemonic == "./DISK" {
+			diskFiles = append(diskFiles, diskFile{name: p.opr.args[0], path: p.opr.label})
+			continue
+		}
+
+		// tests are kept apart from the program
+		if p.opc.mnemonic == ".TEST" {
+			if currentTest != nil {
+				return nil, fmt.Errorf("%s:%d:Missing .end for test %s", p.loc.file, p.loc.line, currentTest.name)
+			}
+			currentTest = &asmTest{name: p.opr.args[0], line: p}
+			continue
+		} else if currentTest != nil {
+			if isTestStep(p.opc.mnemonic) {
+				currentTest.steps = append(currentTest.steps, p)
+				continue
+			} else if p.opc.mnemonic == ".END" {
+				tests = append(tests, *currentTest)
+				currentTest = nil
+				continue
+			}
+			return nil, fmt.Errorf("%s:%d:Only .set, .call and .expect can be used in a test", p.loc.file, p.loc.line)
+		} else if isTestStep(p.opc.mnemonic) {
+			return nil, fmt.Errorf("%s:%d:%s can only be used in a test", p.loc.file, p.loc.line, strings.ToLower(p.opc.mnemonic))
+		} else if p.opc.mnemonic == ".END" {
+			if len(openBlocks) == 0 {
+				return nil, fmt.Errorf("%s:%d:.end without a block to close", p.loc.file, p.loc.line)
+			}
+			blocks[openBlocks[len(openBlocks)-1]].end = currentAddr
+			openBlocks = openBlocks[:len(openBlocks)-1]
+			continue
+		}
+
+		// text settings apply to the lines after them
+		if isTextSetting(p.opc.mnemonic) {
+			if setErr := encoder.set(p.opc.mnemonic, p.opr.args); setErr != nil {
+				return nil, fmt.Errorf("%s:%d:%s", p.loc.file, p.loc.line, setErr.Error())
+			}
+			continue
+		}
+
+		// checks and messages wait until all
+		// the addresses are known
+		if isDiagnostic(p.opc.mnemonic) {
+			diagnostics = append(diagnostics, p)
+			continue
+		}
+
+		// SID tunes go in their own segment at the load
+		// address, the lines after it carry on where they were
+		if p.opc.mnemonic == "./SID" {
+			tune, sidErr := readSID(p.opr.label)
+			if sidErr != nil {
+				return nil, fmt.Errorf("Error when attempting to read %s : %s", p.opr.label, sidErr)
+			} else if symErr := tune.saveSymbols(p.opr.args[0]); symErr != nil {
+				return nil, fmt.Errorf("%s:%d:%s", p.loc.file, p.loc.line, symErr.Error())
+			}
+			programSegments = append(programSegments, tune.segment(currentBank, p.loc))
+			if startAddr == -1 || startAddr > tune.load {
+				startAddr = tune.load
+			}
+			tunes = append(tunes, *tune)
 			continue
 		}
 
@@ -72,31 +223,126 @@ func assemble(programData []tokenizedLine) ([]byte, error) {
 			return nil, fmt.Errorf("No starting address found")
 		}
 
+		// blocks checked once laid out
+		if isBlockStart(p.opc.mnemonic) {
+			blocks = append(blocks, codeBlock{line: p, bank: currentBank, start: currentAddr})
+			openBlocks = append(openBlocks, len(blocks)-1)
+			continue
+		}
+
+		// debugging checkpoints don't take any
+		// space, only keep the address they land at
+		if p.opc.mnemonic == ".BREAK" || p.opc.mnemonic == ".WATCH" {
+			checkpoints = append(checkpoints, checkpoint{addr: currentAddr, line: p})
+			continue
+		}
+
 		// ./bin include command
 		if p.opc.mnemonic == "./BIN" {
-			data, binErr := binInclude(p.opr.label, &currentAddr)
-			if binErr != nil {
-				return nil, fmt.Errorf("Error when attempting to read %s : %s", p.opr.label, binErr)
+			data := binInclude(binData, &currentAddr, p.loc)
+			currentSegment.partiallyAssembled = append(currentSegment.partiallyAssembled, data...)
+			continue
+		}
+
+		// sprites from a PNG sheet, named after the
+		// label of the line or else the file
+		if p.opc.mnemonic == "./SPRITE" {
+			at := fmt.Sprintf("%s:%d", p.loc.file, p.loc.line)
+			data, count, spriteErr := readSprites(p.opr.label, p.opr.args[1] == "multicolor", colorList(p.opr.args[2]))
+			if spriteErr != nil {
+				return nil, fmt.Errorf("Error when attempting to read %s : %s", p.opr.label, spriteErr)
+			}
+			name := graphicsName(p)
+			if symErr := saveSymbol(name+".ptr", spritePointer(currentAddr)); symErr != nil {
+				return nil, fmt.Errorf("%s:%s", at, symErr.Error())
+			} else if symErr := saveSymbol(name+".count", count); symErr != nil {
+				return nil, fmt.Errorf("%s:%s", at, symErr.Error())
+			}
+			if currentAddr%spriteBlock != 0 {
+				warnings = append(warnings, message{
+					text:    fmt.Sprintf("%s:Sprites at $%04x are not aligned to 64 bytes", at, currentAddr),
+					warning: true,
+				})
+			}
+			lines := binInclude(data, &currentAddr, p.loc)
+			currentSegment.partiallyAssembled = append(currentSegment.partiallyAssembled, lines...)
+			continue
+		}
+
+		// character sets and bitmaps, one after the
+		// other with a symbol for each piece
+		if isGraphics(p.opc.mnemonic) {
+			at := fmt.Sprintf("%s:%d", p.loc.file, p.loc.line)
+			g, gErr := convertGraphics(p.opc.mnemonic, p.opr)
+			if gErr != nil {
+				return nil, fmt.Errorf("Error when attempting to read %s : %s", p.opr.label, gErr)
+			}
+			name := graphicsName(p)
+			for _, piece := range g.pieces {
+				if symErr := saveSymbol(name+"."+piece.name, currentAddr); symErr != nil {
+					return nil, fmt.Errorf("%s:%s", at, symErr.Error())
+				}
+				if piece.align > 0 && currentAddr%piece.align != 0 {
+					warnings = append(warnings, message{
+						text:    fmt.Sprintf("%s:%s.%s at $%04x is not aligned to $%04x bytes", at, name, piece.name, currentAddr, piece.align),
+						warning: true,
+					})
+				}
+				lines := binInclude(piece.data, &currentAddr, p.loc)
+				currentSegment.partiallyAssembled = append(currentSegment.partiallyAssembled, lines...)
+			}
+			for _, v := range g.values {
+				if symErr := saveSymbol(name+"."+v.name, v.value); symErr != nil {
+					return nil, fmt.Errorf("%s:%s", at, symErr.Error())
+				}
+			}
+			continue
+		}
+
+		// ./basic include command
+		if p.opc.mnemonic == "./BASIC" {
+			data, basErr := basicInclude(p.opr.label, &currentAddr)
+			if basErr != nil {
+				return nil, fmt.Errorf("Error when attempting to read %s : %s", p.opr.label, basErr)
 			}
 			currentSegment.partiallyAssembled = append(currentSegment.partiallyAssembled, data...)
 			continue
 		}
 
-		// .TEXT and .DFB instructions
-		if p.opc.mnemonic == ".TEXT" || p.opc.mnemonic == "DFB" {
+		// sprites drawn in the sources go in the
+		// same 64 bytes blocks as the ones from images
+		if p.opc.mnemonic == ".SPRITE" && currentAddr%spriteBlock != 0 {
+			warnings = append(warnings, message{
+				text:    fmt.Sprintf("%s:%d:Sprite at $%04x is not aligned to 64 bytes", p.loc.file, p.loc.line, currentAddr),
+				warning: true,
+			})
+		}
+
+		// data lists and the bytes of .SPRITE and .CHAR, the values
+		// of the lists that use labels are resolved with the instructions
+		if isData(p.opc.mnemonic) || isArtBlock(p.opc.mnemonic) {
+
+			data := []dataByte{}
+			if isArtBlock(p.opc.mnemonic) {
+				for _, b := range p.opr.defBytes {
+					data = append(data, dataByte{value: b})
+				}
+			} else {
+				var dataErr error
+				if data, dataErr = encoder.dataBytes(p.opc.mnemonic, p.opr.args); dataErr != nil {
+					return nil, fmt.Errorf("%s:%d:%s", p.loc.file, p.loc.line, dataErr.Error())
+				}
+			}
 
 			// for each byte just use an opcode with the
 			// corresponding hex value
-			for _, b := range p.opr.defBytes {
-				if p.opc.mnemonic == ".TEXT" {
-					b = encodeForC64Screen(b)
-				}
+			for _, b := range data {
 				currentSegment.partiallyAssembled =
 					append(
 						currentSegment.partiallyAssembled,
 						assemblyLine{
 							addr:        currentAddr,
-							data:        &tokenizedLine{opc: opcode{hex: b}},
+							data:        &tokenizedLine{opc: opcode{hex: b.value}, opr: operand{label: b.expr}, loc: p.loc},
 							skipOperand: true,
 						})
 				currentAddr++
@@ -125,59 +371,169 @@ func assemble(programData []tokenizedLine) ([]byte, error) {
 		currentAddr = currentAddr + p.opc.len
 	}
 
+	if currentTest != nil {
+		return nil, fmt.Errorf("%s:%d:Missing .end for test %s", currentTest.line.loc.file, currentTest.line.loc.line, currentTest.name)
+	} else if len(openBlocks) > 0 {
+		open := blocks[openBlocks[len(openBlocks)-1]].line
+		return nil, fmt.Errorf("%s:%d:Missing .end for %s block", open.loc.file, open.loc.line, strings.ToLower(open.opc.mnemonic))
+	}
+
 	// add last segment
 
 	if len(currentSegment.partiallyAssembled) > 0 {
 		programSegments = append(programSegments, currentSegment)
 	}
 
-	// sort and flatten segments into partially assembled result
+	asm := &assembly{
+		startAddr:   startAddr,
+		segments:    programSegments,
+		checkpoints: checkpoints,
+		diskFiles:   diskFiles,
+		tests:       tests,
+		tunes:       tunes,
+	}
+
+	// banks share the same addresses, so each one is
+	// laid out and resolved separately
+	banks := segmentsByBank(programSegments)
+	for _, b := range banks {
 
-	pas, sortSegErr := sortSegments(startAddr, programSegments)
-	if sortSegErr != nil {
-		return nil, sortSegErr
+		bankStart := startAddr
+		if len(banks) > 1 {
+			bankStart = b.start
+		}
+
+		// sort and flatten segments into partially assembled result
+
+		pas, sortSegErr := sortSegments(bankStart, b.segments)
+		if sortSegErr != nil {
+			return nil, sortSegErr
+		}
+
+		// second pass: resolve symbols and write hex values
+
+		image, operands, resolveErr := resolveLines(pas)
+		if resolveErr != nil {
+			return nil, resolveErr
+		}
+		if blockErr := checkBlocks(blocks, b.bank, pas, operands); blockErr != nil {
+			return nil, blockErr
+		}
+
+		asm.lines = append(asm.lines, pas...)
+		b.start = bankStart
+		b.image = image
+		asm.banks = append(asm.banks, b)
 	}
 
-	// prepare buffer
+	messages, diagErr := checkDiagnostics(diagnostics)
+	if diagErr != nil {
+		return nil, diagErr
+	}
+	asm.messages = append(warnings, messages...)
+
+	// a PRG can only hold a single bank, write
+	// the start address at the beginning
+	if len(asm.banks) <= 1 {
+		buffer := new(bytes.Buffer)
+		if bWriteErr := binary.Write(buffer, binary.LittleEndian, uint16(startAddr)); bWriteErr != nil {
+			return nil, bWriteErr
+		}
+		asm.program = buffer.Bytes()
+		if len(asm.banks) == 1 {
+			asm.program = append(asm.program, asm.banks[0].image...)
+		}
+	}
 
-	var program []byte
+	return asm, nil
+}
 
+// segmentsByBank groups the segments by their bank, sorted by
+// bank number, along with the lowest address used in each bank
+func segmentsByBank(segs []segment) []bankImage {
+	banks := []bankImage{}
+	for _, seg := range segs {
+		found := false
+		for i := range banks {
+			if banks[i].bank == seg.bank {
+				banks[i].segments = append(banks[i].segments, seg)
+				if addr := seg.partiallyAssembled[0].addr; addr < banks[i].start {
+					banks[i].start = addr
+				}
+				found = true
+			}
+		}
+		if !found {
+			banks = append(banks, bankImage{
+				bank:     seg.bank,
+				start:    seg.partiallyAssembled[0].addr,
+				segments: []segment{seg},
+			})
+		}
+	}
+	sort.Slice(banks, func(i, j int) bool {
+		return banks[i].bank < banks[j].bank
+	})
+	return banks
+}
+
+// resolveLines writes the bytes of the lines, along with the value
+// of the operand of each one (the target address for branches)
+func resolveLines(pas []assemblyLine) ([]byte, []int, error) {
+
+	var program []byte
 	var pa assemblyLine
 	buffer := new(bytes.Buffer)
-
-	// write the start address at the beginning
-	if bWriteErr := binary.Write(buffer, binary.LittleEndian, uint16(startAddr)); bWriteErr != nil {
-		return nil, bWriteErr
-	}
-	program = append(program, buffer.Bytes()...)
+	operands := make([]int, len(pas))
 
 	// variable definitions for undefined modes lookup
 	var opc opcode
 	var opcFindErr error
 
-	// second pass: resolve symbols and write hex values
 	for i := 0; i < len(pas); i++ {
 		pa = pas[i]
 
 		// resolve symbols
+		operand := pa.data.opr.addr
 		if pa.data.opr.label != "" {
-			if pa.data.opr.label[0] == '[' {
-				if v, formulaErr := resolveFormula(pa.data.opr.label); formulaErr != nil {
-					return nil, formulaErr
-				} else {
-					pa.data.opr.addr = v
-				}
-			} else if v, lookupSymErr := lookupSymbol(pa.data.opr.label); lookupSymErr != nil {
-				return nil, lookupSymErr
+			if v, resolveErr := resolveExpression(pa.data.opr.label); resolveErr != nil {
+				return nil, nil, resolveErr
+			} else {
+				operand = v
+			}
+		}
+		operands[i] = operand
+
+		// bytes of data lists given with labels
+		if pa.data.opc.len == 0 && pa.data.opc.mnemonic == "" && pa.data.opr.label != "" {
+			if operand < 0 || operand > 0xFF {
+				return nil, nil, fmt.Errorf("%s:%d:Value $%x of %s doesn't fit in a byte", pa.data.loc.file, pa.data.loc.line,
+					operand, pa.data.opr.label)
+			}
+			program = append(program, byte(operand))
+			continue
+		}
+
+		// BASIC lines are written as a whole
+		if pa.data.opc.mnemonic == ".BASIC_SYS" || pa.data.opc.mnemonic == "./BASIC" {
+			var line []byte
+			var lineErr error
+			if pa.data.opc.mnemonic == ".BASIC_SYS" {
+				line, lineErr = basicSysLine(pa.addr, operand, pa.data.opr)
 			} else {
-				pa.data.opr.addr = v
+				line, lineErr = basicLine(pa.addr, pa.data.opr)
+			}
+			if lineErr != nil {
+				return nil, nil, fmt.Errorf("%s:%d:%s", pa.data.loc.file, pa.data.loc.line, lineErr.Error())
 			}
+			program = append(program, line...)
+			continue
 		}
 
 		// look for the opcodes with undefined modes
 		if pa.data.opc.mode == UNDEFINED || pa.data.opc.mode == UNDEFINED_X || pa.data.opc.mode == UNDEFINED_Y {
-			if pa.data.opr.addr <= 0xFF {
-				return nil, fmt.Errorf("Labels for Zero-Page addresing modes have to be defined first")
+			if operand <= 0xFF {
+				return nil, nil, fmt.Errorf("Labels for Zero-Page addresing modes have to be defined first")
 			}
 
 			// now we know for sure it's absolute
@@ -192,7 +548,7 @@ func assemble(programData []tokenizedLine) ([]byte, error) {
 				panic("Cannot handle invalid mode")
 			}
 			if opcFindErr != nil {
-				return nil, opcFindErr
+				return nil, nil, opcFindErr
 			} else {
 				// update opcode
 				pa.data.opc = opc
@@ -206,17 +562,18 @@ func assemble(programData []tokenizedLine) ([]byte, error) {
 		if !pa.skipOperand {
 
 			// calculate offset for branch instructions
+			value := operand
 			if isBranchInstruction(pa.data.opc.mnemonic) {
-				offset := calcBranchOffset(pa.addr, pa.data.opr.addr)
+				offset := calcBranchOffset(pa.addr, operand)
 				if offset > 0xFF {
-					return nil, fmt.Errorf("Branch too far: %d, offset: %d", pa.data.opr.addr, offset)
+					return nil, nil, fmt.Errorf("Branch too far: %d, offset: %d", operand, offset)
 				}
-				pa.data.opr.addr = offset
+				value = offset
 			}
 
 			buffer.Reset()
-			if bWriteErr := binary.Write(buffer, binary.LittleEndian, uint16(pa.data.opr.addr)); bWriteErr != nil {
-				return nil, bWriteErr
+			if bWriteErr := binary.Write(buffer, binary.LittleEndian, uint16(value)); bWriteErr != nil {
+				return nil, nil, bWriteErr
 			}
 			if pa.data.opc.len == 2 { // on a 2 byte instruction the operand is 1 byte only
 				program = append(program, buffer.Bytes()[0])
@@ -226,7 +583,7 @@ func assemble(programData []tokenizedLine) ([]byte, error) {
 		}
 	}
 
-	return program, nil
+	return program, operands, nil
 }
 
 func sortSegments(start int, segs []segment) ([]assemblyLine, error) {
@@ -325,45 +682,86 @@ func lookupSymbol(sym string) (int, error) {
 	}
 }
 
+// resolveExpression gets the value of an operand that
+// can be an address, a symbol or a formula
+func resolveExpression(e string) (int, error) {
+	if e[0] == '[' {
+		return resolveFormula(e)
+	}
+	v, sym, err := readAddress(e)
+	if err != nil {
+		return 0, err
+	} else if sym != "" {
+		return lookupSymbol(sym)
+	}
+	return v, nil
+}
+
 func resetSymbols() {
 	symbols = map[string]int{}
 }
 
-func binInclude(filename string, currentAddr *int) (data []assemblyLine, binErr error) {
-	data = []assemblyLine{}
+// ./bin modes for PRG files
+const (
+	binPRG    = "prg" // skips the load address
+	binOrigin = "org" // also sets the origin with it
+)
 
-	bfile, binErr := os.Open(filename)
-	if binErr != nil {
-		return data, binErr
+// readBinFile reads the bytes of a ./bin file. After skipping the
+// bytes asked for the load address is taken from the next two for a
+// PRG, and what's left can be cut to a length.
+func readBinFile(opr operand) ([]byte, int, error) {
+	skip, _ := strconv.Atoi(opr.args[0])
+	length, _ := strconv.Atoi(opr.args[1])
+	mode := opr.args[2]
+
+	data, err := ioutil.ReadFile(opr.label)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	buffer := make([]byte, 1024)
-
-	var readErr error
-	var n int
+	if skip > len(data) {
+		return nil, 0, fmt.Errorf("Cannot skip %d bytes of a %d bytes file", skip, len(data))
+	}
+	data = data[skip:]
 
-	for true {
-		if readErr == io.EOF {
-			break
+	loadAddr := 0
+	if mode == binPRG || mode == binOrigin {
+		if len(data) < 2 {
+			return nil, 0, fmt.Errorf("No load address found")
 		}
+		loadAddr = int(data[0]) | int(data[1])<<8
+		data = data[2:]
+	}
 
-		n, readErr = bfile.Read(buffer)
-		if readErr != nil && readErr != io.EOF {
-			return data, readErr
+	if length >= 0 {
+		if length > len(data) {
+			return nil, 0, fmt.Errorf("Cannot take %d bytes, only %d left", length, len(data))
 		}
+		data = data[:length]
+	}
+	return data, loadAddr, nil
+}
 
-		for i := 0; i < n; i++ {
-			data = append(
-				data,
-				assemblyLine{
-					addr:        *currentAddr,
-					data:        &tokenizedLine{opc: opcode{hex: buffer[i]}},
-					skipOperand: true,
-				})
-			*currentAddr++
-		}
+// isBinWithOrigin tells if the line is a ./bin
+// setting the origin from the load address
+func isBinWithOrigin(p *tokenizedLine) bool {
+	return p.opc.mnemonic == "./BIN" && p.opr.args[2] == binOrigin
+}
+
+func binInclude(bin []byte, currentAddr *int, loc sourceLocation) []assemblyLine {
+	data := []assemblyLine{}
+	for _, b := range bin {
+		data = append(
+			data,
+			assemblyLine{
+				addr:        *currentAddr,
+				data:        &tokenizedLine{opc: opcode{hex: b}, loc: loc},
+				skipOperand: true,
+			})
+		*currentAddr++
 	}
-	return data, binErr
+	return data
 }
 
 // this function is exactly as the
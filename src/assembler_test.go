@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBinInclude(t *testing.T) {
+	defer resetSymbols()
+
+	dir := t.TempDir()
+	// a SID like file: header, load address and the data
+	sid := append(append(bytes.Repeat([]byte{0xEE}, 0x7C), 0x00, 0x10), 1, 2, 3, 4)
+	if err := ioutil.WriteFile(filepath.Join(dir, "music.sid"), sid, 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "my tune.bin"), []byte{1, 2, 3}, 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	var tests = []struct {
+		lines   []string
+		program []byte
+		err     string
+	}{
+		{[]string{".org $c000", "./bin music.sid skip=$7e"}, []byte{0x00, 0xC0, 1, 2, 3, 4}, ""},
+		{[]string{".org $c000", "./bin my tune.bin"}, []byte{0x00, 0xC0, 1, 2, 3}, ""},
+		{[]string{".org $c000", "./bin \"my tune.bin\" skip=1"}, []byte{0x00, 0xC0, 2, 3}, ""},
+		{[]string{".org $c000", "./bin music.sid skip=126 length=2", "\trts"}, []byte{0x00, 0xC0, 1, 2, 0x60}, ""},
+		{[]string{".org $c000", "./bin music.sid skip=$7c prg"}, []byte{0x00, 0xC0, 1, 2, 3, 4}, ""},
+		{[]string{"music ./bin music.sid skip=$7c prg org", ".org $1004", "\tjmp music"}, []byte{0x00, 0x10, 1, 2, 3, 4, 0x4C, 0x00, 0x10}, ""},
+		{[]string{".org $c000", "./bin music.sid skip=$7e length=5"}, nil, "Cannot take 5 bytes, only 4 left"},
+		{[]string{".org $c000", "./bin music.sid skip=200"}, nil, "Cannot skip 200 bytes of a 130 bytes file"},
+	}
+
+	for i, test := range tests {
+		filename := filepath.Join(dir, "bin.asm")
+		if err := ioutil.WriteFile(filename, []byte(strings.Join(test.lines, "\n")), 0644); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		asm, err := assembleSource(t, filename)
+
+		if test.err != "" {
+			if err == nil || !strings.HasSuffix(err.Error(), test.err) {
+				t.Errorf("test %d: expected error %s but got %v", i, test.err, err)
+			}
+		} else if err != nil {
+			t.Errorf("test %d: unexpected error %s", i, err.Error())
+		} else if !bytes.Equal(asm.program, test.program) {
+			t.Errorf("test %d: expected % x but got % x", i, test.program, asm.program)
+		}
+	}
+
+	// options are checked when tokenizing
+	for _, line := range []string{"./bin music.sid org", "./bin music.sid skip=x", "./bin music.sid size=2", "./bin my tune.bin skip=1"} {
+		if _, err := (tokenizer{}).tokenize(line); err == nil {
+			t.Errorf("expected a syntax error for %s", line)
+		}
+	}
+}
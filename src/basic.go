@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// BASIC programs are stored as a chain of lines, each one starting
+// with the address of the next line and its line number (both little
+// endian), followed by the tokenized text and a zero. The program
+// ends with a zero address for the next line.
+
+const (
+	basicTokenSYS       = 0x9E
+	basicSysDigits      = 6 // " 49152", right aligned so the length is fixed
+	basicSysLen         = 2 + 2 + 1 + basicSysDigits + 1 + 2
+	basicSysDefaultLine = 10
+	basicMaxLine        = 63999
+)
+
+// basicSysLine writes the BASIC program `{line} SYS {sysAddr}` at
+// the given address, with the line number taken from the operand
+func basicSysLine(addr, sysAddr int, opr operand) ([]byte, error) {
+
+	if sysAddr < 0 || sysAddr > 0xFFFF {
+		return nil, fmt.Errorf("Out of range address %d for SYS", sysAddr)
+	}
+	lineNum, numErr := strconv.Atoi(opr.args[0])
+	if numErr != nil {
+		return nil, fmt.Errorf("Invalid BASIC line number %s", opr.args[0])
+	}
+
+	next := addr + basicSysLen - 2
+	line := []byte{byte(next), byte(next >> 8), byte(lineNum), byte(lineNum >> 8), basicTokenSYS}
+	line = append(line, fmt.Sprintf("%*d", basicSysDigits, sysAddr)...)
+
+	// end of line and end of program
+	return append(line, 0x00, 0x00, 0x00), nil
+}
+
+// BASIC V2 keywords in the order of the ROM table, their token is
+// $80 plus the index. Lines are crunched like the ROM does it: at each
+// position the first keyword that matches is taken, so `INPUT#` goes
+// before `INPUT` and `GO` is only used when not followed by TO/SUB.
+var basicKeywords = []string{
+	"END", "FOR", "NEXT", "DATA", "INPUT#", "INPUT", "DIM", "READ",
+	"LET", "GOTO", "RUN", "IF", "RESTORE", "GOSUB", "RETURN", "REM",
+	"STOP", "ON", "WAIT", "LOAD", "SAVE", "VERIFY", "DEF", "POKE",
+	"PRINT#", "PRINT", "CONT", "LIST", "CLR", "CMD", "SYS", "OPEN",
+	"CLOSE", "GET", "NEW", "TAB(", "TO", "FN", "SPC(", "THEN",
+	"NOT", "STEP", "+", "-", "*", "/", "^", "AND",
+	"OR", ">", "=", "<", "SGN", "INT", "ABS", "USR",
+	"FRE", "POS", "SQR", "RND", "LOG", "EXP", "COS", "SIN",
+	"TAN", "ATN", "PEEK", "LEN", "STR$", "VAL", "ASC", "CHR$",
+	"LEFT$", "RIGHT$", "MID$", "GO",
+}
+
+const (
+	basicTokenData  = 0x83
+	basicTokenPrint = 0x99
+	basicTokenREM   = 0x8F
+	basicTokenBase  = 0x80
+	basicPrint      = '?' // short for PRINT
+	basicSymDigits  = 5   // symbols are right aligned so the length is fixed
+)
+
+// basicInclude reads a BASIC program from a text file, one line per
+// assembly line so they can be resolved once the symbols are known,
+// followed by the end of program marker
+func basicInclude(filename string, currentAddr *int) ([]assemblyLine, error) {
+
+	source, readErr := ioutil.ReadFile(filename)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	// symbols may not be defined yet, only the length matters now
+	anySymbol := func(string) (int, error) { return 0, nil }
+
+	data := []assemblyLine{}
+	lastNum := -1
+
+	for i, text := range strings.Split(string(source), "\n") {
+		text = strings.TrimRight(text, " \t\r")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		loc := sourceLocation{file: filename, line: i + 1, col1: 1, col2: len(text)}
+
+		lineNum, body, tokErr := tokenizeBasicLine(text, anySymbol)
+		if tokErr != nil {
+			return nil, fmt.Errorf("%s:%d:%s", filename, i+1, tokErr.Error())
+		} else if lineNum <= lastNum {
+			return nil, fmt.Errorf("%s:%d:Line %d is out of order", filename, i+1, lineNum)
+		}
+		lastNum = lineNum
+
+		data = append(data, assemblyLine{
+			addr: *currentAddr,
+			data: &tokenizedLine{
+				opc: opcode{mnemonic: "./BASIC", mode: NOMODE, len: 2 + len(body)},
+				opr: operand{args: []string{text}, mode: NOMODE},
+				loc: loc,
+			},
+			skipOperand: true,
+		})
+		*currentAddr += 2 + len(body)
+	}
+
+	// end of program
+	for i := 0; i < 2; i++ {
+		data = append(data, assemblyLine{
+			addr:        *currentAddr,
+			data:        &tokenizedLine{opc: opcode{hex: 0x00}},
+			skipOperand: true,
+		})
+		*currentAddr++
+	}
+	return data, nil
+}
+
+// basicLine writes a line read by basicInclude with
+// its link to the next one and the symbols resolved
+func basicLine(addr int, opr operand) ([]byte, error) {
+	_, body, tokErr := tokenizeBasicLine(opr.args[0], lookupSymbol)
+	if tokErr != nil {
+		return nil, tokErr
+	}
+	next := addr + 2 + len(body)
+	return append([]byte{byte(next), byte(next >> 8)}, body...), nil
+}
+
+// tokenizeBasicLine returns the line number and the crunched line: the
+// line number (little endian), the text with the keywords tokenized
+// and the zero at the end. Outside quotes `{label}` is replaced
+// with the value of the symbol, in quotes braces are control codes.
+func tokenizeBasicLine(text string, lookup func(string) (int, error)) (int, []byte, error) {
+
+	text = strings.TrimSpace(text)
+	digits := 0
+	for digits < len(text) && text[digits] >= '0' && text[digits] <= '9' {
+		digits++
+	}
+	if digits == 0 {
+		return 0, nil, fmt.Errorf("Missing line number")
+	}
+	lineNum, numErr := strconv.Atoi(text[:digits])
+	if numErr != nil || lineNum > basicMaxLine {
+		return 0, nil, fmt.Errorf("Invalid line number %s", text[:digits])
+	}
+
+	body := []byte{byte(lineNum), byte(lineNum >> 8)}
+	text = strings.TrimLeft(text[digits:], " ")
+
+	quoted := false
+	data := false
+	for i := 0; i < len(text); {
+		c := text[i]
+
+		// braces
+		if c == '{' {
+			end := strings.IndexByte(text[i:], '}')
+			if end < 0 {
+				return 0, nil, fmt.Errorf("Missing '}' in %s", text[i:])
+			}
+			name := text[i+1 : i+end]
+			i += end + 1
+
+			if quoted {
+				codes, escErr := readPetsciiEscape(name)
+				if escErr != nil {
+					return 0, nil, escErr
+				}
+				body = append(body, codes...)
+				continue
+			}
+			v, symErr := lookup(name)
+			if symErr != nil {
+				return 0, nil, symErr
+			} else if v < 0 || v > 0xFFFF {
+				return 0, nil, fmt.Errorf("Out of range value %d for %s", v, name)
+			}
+			body = append(body, fmt.Sprintf("%*d", basicSymDigits, v)...)
+			continue
+		}
+
+		if c == '"' {
+			quoted = !quoted
+		}
+
+		// keywords, but not in strings or data
+		if !quoted && !data {
+			if c == basicPrint {
+				body = append(body, basicTokenPrint)
+				i++
+				continue
+			}
+			if token, kwLen := matchBasicKeyword(text[i:]); kwLen > 0 {
+				body = append(body, token)
+				i += kwLen
+
+				// the rest of the line is left as it is
+				if token == basicTokenREM {
+					rest, restErr := basicText(text[i:])
+					if restErr != nil {
+						return 0, nil, restErr
+					}
+					body = append(body, rest...)
+					break
+				}
+				data = token == basicTokenData
+				continue
+			}
+		} else if data && !quoted && c == ':' {
+			data = false
+		}
+
+		// upper case outside of strings, as typed in
+		if !quoted && c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		pc, pcErr := basicChar(c, quoted)
+		if pcErr != nil {
+			return 0, nil, pcErr
+		}
+		body = append(body, pc)
+		i++
+	}
+
+	if len(body)+4 > 0xFF {
+		return 0, nil, fmt.Errorf("Line %d is too long", lineNum)
+	}
+	return lineNum, append(body, 0x00), nil
+}
+
+// matchBasicKeyword returns the token and the length
+// of the keyword at the start of the text, if any
+func matchBasicKeyword(text string) (byte, int) {
+	for i, kw := range basicKeywords {
+		if len(text) >= len(kw) && strings.EqualFold(text[:len(kw)], kw) {
+			return byte(basicTokenBase + i), len(kw)
+		}
+	}
+	return 0, 0
+}
+
+// basicText converts the text after a REM, where control codes
+// are allowed but there are no keywords nor symbols
+func basicText(text string) ([]byte, error) {
+	b := []byte{}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '{' {
+			end := strings.IndexByte(text[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("Missing '}' in %s", text[i:])
+			}
+			codes, escErr := readPetsciiEscape(text[i+1 : i+end])
+			if escErr != nil {
+				return nil, escErr
+			}
+			b = append(b, codes...)
+			i += end
+			continue
+		}
+		pc, pcErr := basicChar(text[i], true)
+		if pcErr != nil {
+			return nil, pcErr
+		}
+		b = append(b, pc)
+	}
+	return b, nil
+}
+
+func basicChar(c byte, quoted bool) (byte, error) {
+	if !quoted && c >= 'A' && c <= 'Z' {
+		return c, nil
+	}
+	return asciiToPetscii(c)
+}
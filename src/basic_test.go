@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTokenizeBasicLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected []byte
+	}{{
+		`10 print "hi"`,
+		[]byte{0x0A, 0x00, 0x99, ' ', '"', 'H', 'I', '"', 0x00},
+	}, {
+		`20 goto10:go sub 20`,
+		[]byte{0x14, 0x00, 0x89, '1', '0', ':', 0xCB, ' ', 'S', 'U', 'B', ' ', '2', '0', 0x00},
+	}, {
+		`30 ?"{clr}{2 down}{$41}":input#1,a$`,
+		[]byte{0x1E, 0x00, 0x99, '"', 0x93, 0x11, 0x11, 0x41, '"', ':', 0x84, '1', ',', 'A', '$', 0x00},
+	}, {
+		`40 data print,"to":to`,
+		[]byte{0x28, 0x00, 0x83, ' ', 'P', 'R', 'I', 'N', 'T', ',', '"', 'T', 'O', '"', ':', 0xA4, 0x00},
+	}, {
+		`50 rem print{red}`,
+		[]byte{0x32, 0x00, 0x8F, ' ', 'P', 'R', 'I', 'N', 'T', 0x1C, 0x00},
+	}, {
+		`60 sys{start}`,
+		[]byte{0x3C, 0x00, 0x9E, '4', '9', '1', '5', '2', 0x00},
+	}, {
+		`63999 poke{screen},{start}`,
+		[]byte{0xFF, 0xF9, 0x97, ' ', '1', '0', '2', '4', ',', '4', '9', '1', '5', '2', 0x00},
+	}}
+
+	resetSymbols()
+	defer resetSymbols()
+	symbols["start"] = 0xC000
+	symbols["screen"] = 0x0400
+
+	for _, test := range tests {
+		_, body, err := tokenizeBasicLine(test.line, lookupSymbol)
+		if err != nil {
+			t.Errorf("%s: %s", test.line, err.Error())
+		} else if !bytes.Equal(body, test.expected) {
+			t.Errorf("%s: expected % x but got % x", test.line, test.expected, body)
+		}
+	}
+
+	for _, line := range []string{`print`, `10 sys{undefined}`, `70 print "{nothing}"`, `64000 end`} {
+		if _, _, err := tokenizeBasicLine(line, lookupSymbol); err == nil {
+			t.Errorf("%s: expected an error", line)
+		}
+	}
+}
+
+func TestBasicSysLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected []byte
+		err      string
+	}{{
+		".basic_sys $c000",
+		[]byte{0x0D, 0x08, 0x0A, 0x00, 0x9E, ' ', '4', '9', '1', '5', '2', 0x00, 0x00, 0x00}, "",
+	}, {
+		".basic_sys 2064, 2012",
+		[]byte{0x0D, 0x08, 0xDC, 0x07, 0x9E, ' ', ' ', '2', '0', '6', '4', 0x00, 0x00, 0x00}, "",
+	}, {
+		".basic_sys $0810,63999",
+		[]byte{0x0D, 0x08, 0xFF, 0xF9, 0x9E, ' ', ' ', '2', '0', '6', '4', 0x00, 0x00, 0x00}, "",
+	}, {
+		".basic_sys $c000, 64000", nil, "Invalid BASIC line number 64000",
+	}, {
+		".basic_sys $c000, ten", nil, "Invalid BASIC line number ten",
+	}, {
+		".basic_sys $10000", nil, "Out of range address 65536 for SYS",
+	}}
+
+	for _, test := range tests {
+		tl, err := tokenizer{}.tokenize(test.line)
+		var line []byte
+		if err == nil {
+			line, err = basicSysLine(0x0801, tl.opr.addr, tl.opr)
+		}
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s: expected error %q but got %v", test.line, test.err, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error %s", test.line, err.Error())
+		} else if !bytes.Equal(line, test.expected) {
+			t.Errorf("%s: expected % x but got % x", test.line, test.expected, line)
+		}
+	}
+
+	// the line number is kept as text in the operand
+	if _, err := basicSysLine(0x0801, 0xC000, operand{args: []string{"x"}}); err == nil {
+		t.Errorf("expected an error for an invalid line number")
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Blocks of code closed with .end that are checked once laid out:
+//
+//	.nopagecross
+//	loop:	lda table,x
+//		dex
+//		bne loop
+//	table	dfb 1,2,3
+//	.end
+//
+// fails if a branch in it lands on another page than the instruction
+// after it, or if an indexed read in it of a table in the program runs
+// into the next page, since both cost an extra cycle, and
+//
+//	.timed 9
+//		nop
+//		nop
+//		bit $ea
+//		nop
+//	.end
+//
+// fails unless the straight-line code in it takes exactly 9 cycles.
+// Indexed accesses are counted as if they didn't cross a page, keep
+// them in a .nopagecross block to make sure of it. A table is the run
+// of data lines starting at the address read, reads of anything else
+// (like registers or memory set at run time) aren't checked.
+
+type codeBlock struct {
+	line       *tokenizedLine
+	bank       int
+	start, end int // addresses, end not included
+}
+
+// isBlockStart tells if the directive opens a block closed by .end
+func isBlockStart(mnemonic string) bool {
+	return mnemonic == ".NOPAGECROSS" || mnemonic == ".TIMED"
+}
+
+// checkBlocks checks the blocks in the resolved lines of a bank,
+// given with the value of the operand of each line
+func checkBlocks(blocks []codeBlock, bank int, pas []assemblyLine, operands []int) error {
+	for _, b := range blocks {
+		if b.bank != bank {
+			continue
+		}
+
+		inBlock := []assemblyLine{}
+		for _, pa := range pas {
+			if pa.addr >= b.start && pa.addr < b.end {
+				inBlock = append(inBlock, pa)
+			}
+		}
+
+		var err error
+		if b.line.opc.mnemonic == ".NOPAGECROSS" {
+			err = checkNoPageCross(b, pas, operands)
+		} else {
+			err = checkTimed(b, inBlock)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkNoPageCross checks the branches and indexed reads of the block
+// in the lines of its bank, the code itself can cross pages freely
+func checkNoPageCross(b codeBlock, pas []assemblyLine, operands []int) error {
+	for i, pa := range pas {
+		if pa.addr < b.start || pa.addr >= b.end {
+			continue
+		}
+		at := fmt.Sprintf("%s:%d", pa.data.loc.file, pa.data.loc.line)
+		opc := pa.data.opc
+
+		switch {
+		case isBranchInstruction(opc.mnemonic):
+			next := pa.addr + opc.len
+			if target := operands[i]; target>>8 != next>>8 {
+				return fmt.Errorf("%s:Branch to $%04x crosses a page inside a .nopagecross block", at, target)
+			}
+		case opc.crossesPage && (opc.mode == ABSX || opc.mode == ABSY):
+			base := operands[i]
+			if last := tableEnd(pas, base); last>>8 != base>>8 {
+				return fmt.Errorf("%s:Indexed read of the table at $%04x crosses a page at $%04x inside a .nopagecross block",
+					at, base, last&0xFF00)
+			}
+		}
+	}
+	return nil
+}
+
+// tableEnd returns the last address of the run of data lines
+// starting at an address, the address itself if there's no data
+func tableEnd(pas []assemblyLine, addr int) int {
+	last := addr
+	for _, pa := range pas {
+		end := pa.addr + pa.size() - 1
+		if end < addr {
+			continue
+		} else if pa.addr > last+1 || !isDataLine(pa) {
+			break
+		}
+		last = end
+	}
+	return last
+}
+
+// isDataLine tells if the line holds data instead of an instruction
+func isDataLine(pa assemblyLine) bool {
+	mnemonic := pa.data.opc.mnemonic
+	return mnemonic == "" || strings.HasPrefix(mnemonic, ".")
+}
+
+func checkTimed(b codeBlock, lines []assemblyLine) error {
+	expected, err := resolveExpression(b.line.opr.args[0])
+	if err != nil {
+		return fmt.Errorf("%s:%d:%s", b.line.loc.file, b.line.loc.line, err.Error())
+	}
+
+	cycles := 0
+	for _, pa := range lines {
+		at := fmt.Sprintf("%s:%d", pa.data.loc.file, pa.data.loc.line)
+		mnemonic := pa.data.opc.mnemonic
+
+		switch {
+		case isDataLine(pa):
+			return fmt.Errorf("%s:Data can't be timed in a .timed block", at)
+		case isBranchInstruction(mnemonic), isControlTransfer(mnemonic):
+			return fmt.Errorf("%s:Only straight-line code can be timed, found %s", at, strings.ToLower(mnemonic))
+		}
+		cycles += pa.data.opc.cycles
+	}
+
+	if cycles != expected {
+		return fmt.Errorf("%s:%d:Timed block takes %d cycles instead of %d", b.line.loc.file, b.line.loc.line, cycles, expected)
+	}
+	return nil
+}
+
+// isControlTransfer tells if the instruction
+// jumps somewhere else, besides the branches
+func isControlTransfer(mnemonic string) bool {
+	switch mnemonic {
+	case "JMP", "JSR", "RTS", "RTI", "BRK":
+		return true
+	}
+	return false
+}
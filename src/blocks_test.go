@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBlocks(t *testing.T) {
+	defer resetSymbols()
+
+	var tests = []struct {
+		lines []string
+		err   string
+	}{
+		// fits in the page
+		{[]string{"\t.org $c0f0", ".nopagecross", "loop:\tlda table,x", "\tdex", "\tbne loop", "table\tdfb 1,2,3", ".end"}, ""},
+		// the table read runs into the next page
+		{[]string{"\t.org $c0f8", ".nopagecross", "loop:\tlda table,x", "\tdex", "\tbne loop", "table\tdfb 1,2,3", ".end"}, ":3:Indexed read of the table at $c0fe crosses a page at $c100 inside a .nopagecross block"},
+		{[]string{"\t.org $c0f8", ".nopagecross", "\tlda table,y", ".end", "\tnop", "\tnop", "\tnop", "table\tdfb 1,2,3"}, ":3:Indexed read of the table at $c0fe crosses a page at $c100 inside a .nopagecross block"},
+		{[]string{"\t.org $c0f8", ".nopagecross", "\tlda table,y", ".end", "\tnop", "\tnop", "table\tdfb 1,2,3", "\tnop"}, ""},
+		// stores take the extra cycle anyway and registers aren't tables
+		{[]string{"\t.org $c0f8", ".nopagecross", "\tsta table,x", "\tlda $d000,x", ".end", "table\tdfb 1,2,3,4,5,6"}, ""},
+		// an instruction split between pages costs nothing
+		{[]string{"\t.org $c0fe", ".nopagecross", "\tlda $1234", ".end"}, ""},
+		// a branch out of the block landing on the page before
+		{[]string{"\t.org $c0fe", "back:\tnop", "\tnop", ".nopagecross", "\tbne back", ".end"}, ":5:Branch to $c0fe crosses a page inside a .nopagecross block"},
+		{[]string{"\t.org $c0fe", "\tnop", "\tnop", ".nopagecross", "\tbne $c0fe", ".end"}, ":5:Branch to $c0fe crosses a page inside a .nopagecross block"},
+		{[]string{"\t.org $c000", ".timed 9", "\tnop", "\tnop", "\tbit $ea", "\tnop", ".end"}, ""},
+		{[]string{"\t.org $c000", "cycles = 10", ".timed cycles", "\tnop", "\tlda $d012", "\tsta $d020", ".end"}, ""},
+		{[]string{"\t.org $c000", ".timed 8", "\tnop", "\tnop", ".end"}, ":2:Timed block takes 4 cycles instead of 8"},
+		{[]string{"\t.org $c000", ".timed 4", "loop:\tdex", "\tbne loop", ".end"}, ":4:Only straight-line code can be timed, found bne"},
+		{[]string{"\t.org $c000", ".timed 4", "\tnop", "\tdfb 1", ".end"}, ":4:Data can't be timed in a .timed block"},
+		// nested blocks
+		{[]string{"\t.org $c0fc", ".nopagecross", ".timed 4", "\tnop", "\tnop", ".end", "back\tbne back", ".end"}, ":7:Branch to $c0fe crosses a page inside a .nopagecross block"},
+		{[]string{"\t.org $c000", ".timed 2", "\tnop", ".org $c100", ".end"}, ":4:.org inside the .timed block at line 2"},
+		{[]string{"\t.org $c000", ".nopagecross", "\tnop"}, ":2:Missing .end for .nopagecross block"},
+		{[]string{"\t.org $c000", "\tnop", ".end"}, ":3:.end without a block to close"},
+	}
+
+	for i, test := range tests {
+		_, err := assembleLines(t, test.lines)
+
+		if test.err == "" && err != nil {
+			t.Errorf("test %d: unexpected error %s", i, err.Error())
+		} else if test.err != "" && (err == nil || !strings.HasSuffix(err.Error(), test.err)) {
+			t.Errorf("test %d: expected error %s but got %v", i, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"fmt"
+)
+
+// A 6502 core for running routines without an emulator. Instructions
+// are decoded with the `opcodes` table, which also gives the cycles
+// taken by each one. Decimal mode follows the NMOS 6502 behaviour.
+
+// status register flags
+const (
+	flagC byte = 1 << iota
+	flagZ
+	flagI
+	flagD
+	flagB
+	flagU // unused, always set
+	flagV
+	flagN
+)
+
+const (
+	stackPage   = 0x0100
+	irqVector   = 0xFFFE
+	irqCycles   = 7
+	resetStatus = flagU | flagI
+)
+
+type cpu struct {
+	a, x, y byte
+	sp      byte
+	p       byte
+	pc      int
+	cycles  int
+	mem     [0x10000]byte
+
+	// routines done in Go, by entry point
+	hooks map[int]hook
+
+	// the raster and its interrupts, if simulated
+	vic *vic
+}
+
+func newCPU() *cpu {
+	return &cpu{sp: 0xFF, p: resetStatus}
+}
+
+// load copies a PRG (load address included) into memory
+func (c *cpu) load(program []byte) {
+	start := int(program[0]) | int(program[1])<<8
+	copy(c.mem[start:], program[2:])
+}
+
+func (c *cpu) read(addr int) byte {
+	addr &= 0xFFFF
+	if c.vic != nil && addr >= 0xD000 && addr < 0xD400 {
+		if v, found := c.vic.read(c, addr); found {
+			return v
+		}
+	}
+	return c.mem[addr]
+}
+
+func (c *cpu) write(addr int, v byte) {
+	addr &= 0xFFFF
+	if c.vic != nil && addr >= 0xD000 && addr < 0xD400 {
+		c.vic.write(c, addr, v)
+		return
+	}
+	c.mem[addr] = v
+}
+
+func (c *cpu) read16(addr int) int {
+	return int(c.read(addr)) | int(c.read(addr+1))<<8
+}
+
+// read16ZP reads a pointer in the zero page, wrapping around in it
+func (c *cpu) read16ZP(addr int) int {
+	return int(c.read(addr&0xFF)) | int(c.read((addr+1)&0xFF))<<8
+}
+
+func (c *cpu) push(v byte) {
+	c.write(stackPage|int(c.sp), v)
+	c.sp--
+}
+
+func (c *cpu) pull() byte {
+	c.sp++
+	return c.read(stackPage | int(c.sp))
+}
+
+func (c *cpu) flag(f byte) bool {
+	return c.p&f != 0
+}
+
+func (c *cpu) setFlag(f byte, on bool) {
+	if on {
+		c.p |= f
+	} else {
+		c.p &^= f
+	}
+}
+
+func (c *cpu) setNZ(v byte) {
+	c.setFlag(flagZ, v == 0)
+	c.setFlag(flagN, v&0x80 != 0)
+}
+
+// fetch returns the opcode at the program
+// counter and its operand, without running it
+func (c *cpu) fetch() (*opcode, int, error) {
+	opc := opcodeByHex(c.read(c.pc))
+	if opc == nil {
+		return nil, 0, fmt.Errorf("Illegal opcode $%02x at $%04x", c.read(c.pc), c.pc)
+	}
+	operand := 0
+	switch opc.len {
+	case 2:
+		operand = int(c.read(c.pc + 1))
+	case 3:
+		operand = c.read16(c.pc + 1)
+	}
+	return opc, operand, nil
+}
+
+// effectiveAddr returns the address used by the instruction
+// and if indexing it crossed into a different page
+func (c *cpu) effectiveAddr(mode string, operand int) (int, bool) {
+	indexed := func(base int, index byte) (int, bool) {
+		addr := (base + int(index)) & 0xFFFF
+		return addr, addr&0xFF00 != base&0xFF00
+	}
+
+	switch mode {
+	case ZP, ABS:
+		return operand, false
+	case ZPX:
+		return (operand + int(c.x)) & 0xFF, false
+	case ZPY:
+		return (operand + int(c.y)) & 0xFF, false
+	case ABSX:
+		return indexed(operand, c.x)
+	case ABSY:
+		return indexed(operand, c.y)
+	case IND:
+		// the NMOS 6502 doesn't carry into the high
+		// byte when the pointer is at the end of a page
+		return int(c.read(operand)) | int(c.read(operand&0xFF00|(operand+1)&0xFF))<<8, false
+	case IX:
+		return c.read16ZP(operand + int(c.x)), false
+	case IY:
+		return indexed(c.read16ZP(operand), c.y)
+	}
+	return 0, false
+}
+
+// step runs the instruction at the program counter
+func (c *cpu) step() error {
+
+	opc, operand, err := c.fetch()
+	if err != nil {
+		return err
+	}
+
+	c.pc = (c.pc + opc.len) & 0xFFFF
+	cycles := opc.cycles
+
+	addr, crossed := c.effectiveAddr(opc.mode, operand)
+	if crossed && opc.crossesPage {
+		cycles++
+	}
+
+	load := func() byte {
+		switch opc.mode {
+		case IM:
+			return byte(operand)
+		case ACC:
+			return c.a
+		}
+		return c.read(addr)
+	}
+	store := func(v byte) {
+		if opc.mode == ACC {
+			c.a = v
+		} else {
+			c.write(addr, v)
+		}
+	}
+	// read-modify-write instructions write back the value read
+	// before the result, which acknowledges the VIC-II interrupts
+	modify := func(old, v byte) {
+		if opc.mode != ACC {
+			c.write(addr, old)
+		}
+		store(v)
+	}
+	branch := func(taken bool) {
+		if !taken {
+			return
+		}
+		cycles++
+		target := (c.pc + int(int8(operand))) & 0xFFFF
+		if target&0xFF00 != c.pc&0xFF00 {
+			cycles++
+		}
+		c.pc = target
+	}
+	compare := func(reg byte) {
+		v := load()
+		c.setFlag(flagC, reg >= v)
+		c.setNZ(reg - v)
+	}
+
+	switch opc.mnemonic {
+
+	// loads, stores and transfers
+	case "LDA":
+		c.a = load()
+		c.setNZ(c.a)
+	case "LDX":
+		c.x = load()
+		c.setNZ(c.x)
+	case "LDY":
+		c.y = load()
+		c.setNZ(c.y)
+	case "STA":
+		store(c.a)
+	case "STX":
+		store(c.x)
+	case "STY":
+		store(c.y)
+	case "TAX":
+		c.x = c.a
+		c.setNZ(c.x)
+	case "TAY":
+		c.y = c.a
+		c.setNZ(c.y)
+	case "TXA":
+		c.a = c.x
+		c.setNZ(c.a)
+	case "TYA":
+		c.a = c.y
+		c.setNZ(c.a)
+	case "TSX":
+		c.x = c.sp
+		c.setNZ(c.x)
+	case "TXS":
+		c.sp = c.x
+
+	// stack
+	case "PHA":
+		c.push(c.a)
+	case "PHP":
+		c.push(c.p | flagB | flagU)
+	case "PLA":
+		c.a = c.pull()
+		c.setNZ(c.a)
+	case "PLP":
+		c.p = c.pull()&^flagB | flagU
+
+	// arithmetic and logic
+	case "ADC":
+		c.adc(load())
+	case "SBC":
+		c.sbc(load())
+	case "AND":
+		c.a &= load()
+		c.setNZ(c.a)
+	case "ORA":
+		c.a |= load()
+		c.setNZ(c.a)
+	case "EOR":
+		c.a ^= load()
+		c.setNZ(c.a)
+	case "BIT":
+		v := load()
+		c.setFlag(flagZ, c.a&v == 0)
+		c.setFlag(flagN, v&0x80 != 0)
+		c.setFlag(flagV, v&0x40 != 0)
+	case "CMP":
+		compare(c.a)
+	case "CPX":
+		compare(c.x)
+	case "CPY":
+		compare(c.y)
+
+	// increments and decrements
+	case "INC":
+		old := load()
+		modify(old, old+1)
+		c.setNZ(old + 1)
+	case "DEC":
+		old := load()
+		modify(old, old-1)
+		c.setNZ(old - 1)
+	case "INX":
+		c.x++
+		c.setNZ(c.x)
+	case "INY":
+		c.y++
+		c.setNZ(c.y)
+	case "DEX":
+		c.x--
+		c.setNZ(c.x)
+	case "DEY":
+		c.y--
+		c.setNZ(c.y)
+
+	// shifts and rotations
+	case "ASL":
+		old := load()
+		c.setFlag(flagC, old&0x80 != 0)
+		v := old << 1
+		modify(old, v)
+		c.setNZ(v)
+	case "LSR":
+		old := load()
+		c.setFlag(flagC, old&0x01 != 0)
+		v := old >> 1
+		modify(old, v)
+		c.setNZ(v)
+	case "ROL":
+		old := load()
+		carry := c.p & flagC
+		c.setFlag(flagC, old&0x80 != 0)
+		v := old<<1 | carry
+		modify(old, v)
+		c.setNZ(v)
+	case "ROR":
+		old := load()
+		carry := c.p & flagC
+		c.setFlag(flagC, old&0x01 != 0)
+		v := old>>1 | carry<<7
+		modify(old, v)
+		c.setNZ(v)
+
+	// jumps and returns
+	case "JMP":
+		c.pc = addr
+	case "JSR":
+		ret := c.pc - 1
+		c.push(byte(ret >> 8))
+		c.push(byte(ret))
+		c.pc = addr
+	case "RTS":
+		c.rts()
+	case "RTI":
+		c.rti()
+	case "BRK":
+		ret := c.pc + 1
+		c.push(byte(ret >> 8))
+		c.push(byte(ret))
+		c.push(c.p | flagB | flagU)
+		c.setFlag(flagI, true)
+		c.pc = c.read16(irqVector)
+
+	// branches
+	case "BCC":
+		branch(!c.flag(flagC))
+	case "BCS":
+		branch(c.flag(flagC))
+	case "BNE":
+		branch(!c.flag(flagZ))
+	case "BEQ":
+		branch(c.flag(flagZ))
+	case "BPL":
+		branch(!c.flag(flagN))
+	case "BMI":
+		branch(c.flag(flagN))
+	case "BVC":
+		branch(!c.flag(flagV))
+	case "BVS":
+		branch(c.flag(flagV))
+
+	// flags
+	case "CLC":
+		c.setFlag(flagC, false)
+	case "SEC":
+		c.setFlag(flagC, true)
+	case "CLI":
+		c.setFlag(flagI, false)
+	case "SEI":
+		c.setFlag(flagI, true)
+	case "CLD":
+		c.setFlag(flagD, false)
+	case "SED":
+		c.setFlag(flagD, true)
+	case "CLV":
+		c.setFlag(flagV, false)
+
+	case "NOP":
+	default:
+		return fmt.Errorf("Unsupported instruction %s at $%04x", opc.mnemonic, c.pc)
+	}
+
+	c.cycles += cycles
+	return nil
+}
+
+// interrupt enters the IRQ handler at the vector
+// as the 6502 does when the interrupt line is low
+func (c *cpu) interrupt() {
+	c.push(byte(c.pc >> 8))
+	c.push(byte(c.pc))
+	c.push(c.p&^flagB | flagU)
+	c.setFlag(flagI, true)
+	c.pc = c.read16(irqVector)
+	c.cycles += irqCycles
+}
+
+// rti returns from an interrupt
+func (c *cpu) rti() {
+	c.p = c.pull()&^flagB | flagU
+	lo := int(c.pull())
+	c.pc = lo | int(c.pull())<<8
+}
+
+// rts returns to the address pushed by a JSR
+func (c *cpu) rts() {
+	lo := int(c.pull())
+	c.pc = ((lo | int(c.pull())<<8) + 1) & 0xFFFF
+}
+
+func (c *cpu) adc(v byte) {
+	carry := int(c.p & flagC)
+
+	if !c.flag(flagD) {
+		sum := int(c.a) + int(v) + carry
+		c.setFlag(flagV, (^(c.a^v))&(c.a^byte(sum))&0x80 != 0)
+		c.setFlag(flagC, sum > 0xFF)
+		c.a = byte(sum)
+		c.setNZ(c.a)
+		return
+	}
+
+	// the zero flag comes from the binary sum and the
+	// negative and overflow ones before the last adjust
+	c.setFlag(flagZ, byte(int(c.a)+int(v)+carry) == 0)
+	lo := int(c.a&0x0F) + int(v&0x0F) + carry
+	if lo > 9 {
+		lo += 6
+	}
+	hi := int(c.a>>4) + int(v>>4)
+	if lo > 0x0F {
+		hi++
+	}
+	c.setFlag(flagN, hi&0x08 != 0)
+	c.setFlag(flagV, (^(c.a^v))&(c.a^byte(hi<<4))&0x80 != 0)
+	if hi > 9 {
+		hi += 6
+	}
+	c.setFlag(flagC, hi > 0x0F)
+	c.a = byte(hi<<4) | byte(lo&0x0F)
+}
+
+func (c *cpu) sbc(v byte) {
+	borrow := 1 - int(c.p&flagC)
+
+	// flags are always the ones of the binary subtraction
+	diff := int(c.a) - int(v) - borrow
+	c.setFlag(flagV, (c.a^v)&(c.a^byte(diff))&0x80 != 0)
+	c.setFlag(flagC, diff >= 0)
+
+	if !c.flag(flagD) {
+		c.a = byte(diff)
+		c.setNZ(c.a)
+		return
+	}
+
+	c.setNZ(byte(diff))
+	lo := int(c.a&0x0F) - int(v&0x0F) - borrow
+	hi := int(c.a>>4) - int(v>>4)
+	if lo < 0 {
+		lo -= 6
+		hi--
+	}
+	if hi < 0 {
+		hi -= 6
+	}
+	c.a = byte(hi<<4) | byte(lo&0x0F)
+}
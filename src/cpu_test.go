@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRunMultiplyAndDivide(t *testing.T) {
+	defer resetSymbols()
+
+	asm := assembleTestFile(t, "../examples/005_mult_and_div.asm")
+
+	for _, test := range [][2]int{{7, 9}, {200, 120}, {100, 7}, {0, 3}} {
+		c := newCPU()
+		c.load(asm.program)
+		c.write(0xFC, byte(test[0]))
+		c.write(0xFD, byte(test[1]))
+		if _, err := runRoutine(c, symbols["multiply"], defaultCycleLimit, nil); err != nil {
+			t.Fatal(err.Error())
+		}
+		if product := int(c.read(0xFE)) | int(c.read(0xFF))<<8; product != test[0]*test[1] {
+			t.Errorf("%d * %d: expected %d but got %d", test[0], test[1], test[0]*test[1], product)
+		}
+
+		c.write(0xFC, byte(test[0]))
+		c.write(0xFD, byte(test[1]))
+		if _, err := runRoutine(c, symbols["divide"], defaultCycleLimit, nil); err != nil {
+			t.Fatal(err.Error())
+		}
+		if c.read(0xFE) != byte(test[0]/test[1]) || c.a != byte(test[0]%test[1]) {
+			t.Errorf("%d / %d: got %d remainder %d", test[0], test[1], c.read(0xFE), c.a)
+		}
+	}
+}
+
+func TestCPUInstructions(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   []byte
+		a      byte
+		p      byte
+		cycles int
+	}{{
+		"adc with overflow",
+		[]byte{0x18, 0xA9, 0x50, 0x69, 0x50}, // clc, lda #$50, adc #$50
+		0xA0, flagN | flagV, 6,
+	}, {
+		"decimal adc",
+		[]byte{0xF8, 0x38, 0xA9, 0x19, 0x69, 0x28}, // sed, sec, lda #$19, adc #$28
+		0x48, flagD, 8,
+	}, {
+		"decimal sbc with borrow",
+		[]byte{0xF8, 0x38, 0xA9, 0x10, 0xE9, 0x01}, // sed, sec, lda #$10, sbc #$01
+		0x09, flagD | flagC, 8,
+	}, {
+		"indexed page crossing",
+		[]byte{0xA2, 0xFF, 0xBD, 0x01, 0x10}, // ldx #$ff, lda $1001,x
+		0x00, flagZ, 7,
+	}, {
+		"branch taken to another page",
+		[]byte{0xA9, 0x00, 0xF0, 0x7F}, // lda #0, beq +127
+		0x00, flagZ, 6,
+	}, {
+		"rotate through carry",
+		[]byte{0x38, 0xA9, 0x80, 0x2A}, // sec, lda #$80, rol a
+		0x01, flagC, 6,
+	}, {
+		"stack",
+		[]byte{0xA9, 0x42, 0x48, 0xA9, 0x00, 0x68}, // lda #$42, pha, lda #0, pla
+		0x42, 0, 11,
+	}}
+
+	for _, test := range tests {
+		c := newCPU()
+		c.p = flagU
+		copy(c.mem[0x10F0:], test.code)
+		c.pc = 0x10F0
+		for c.pc < 0x10F0+len(test.code) {
+			if err := c.step(); err != nil {
+				t.Fatalf("%s: %s", test.name, err.Error())
+			}
+		}
+		if c.a != test.a || c.p != test.p|flagU || c.cycles != test.cycles {
+			t.Errorf(
+				"%s: expected A=%02x P=%02x %d cycles but got A=%02x P=%02x %d cycles",
+				test.name, test.a, test.p|flagU, test.cycles, c.a, c.p, c.cycles)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// CRT cartridge images start with a 64 bytes header describing the
+// hardware, followed by CHIP packets with the contents of each ROM
+// (or flash) chip, its bank and the address it's mapped to. All
+// the values in a CRT are big endian.
+
+const (
+	crtHeaderLen  = 0x40
+	crtVersion    = 0x0100
+	crtChipHeader = 0x10
+	crtChipROM    = 0
+	crtChipFlash  = 2
+	crtWindowSize = 0x2000
+	crtFill       = 0xFF // unused bytes in a chip, like an erased EPROM
+)
+
+// crtType describes a cartridge hardware: its type in the header,
+// the state of the EXROM and GAME lines (0 active) and the 8K
+// windows where its banks can be mapped
+type crtType struct {
+	hwType   uint16
+	exrom    byte
+	game     byte
+	chip     uint16
+	windows  []int
+	maxBanks int
+	chipSize int // only for 16K chips, 8K otherwise
+}
+
+var crtTypes = map[string]crtType{
+	"normal8k":  crtType{hwType: 0, exrom: 0, game: 1, chip: crtChipROM, windows: []int{0x8000}, maxBanks: 1},
+	"normal16k": crtType{hwType: 0, exrom: 0, game: 0, chip: crtChipROM, windows: []int{0x8000}, maxBanks: 1, chipSize: 0x4000},
+	"ultimax":   crtType{hwType: 0, exrom: 1, game: 0, chip: crtChipROM, windows: []int{0x8000, 0xE000}, maxBanks: 1},
+	"ocean":     crtType{hwType: 5, exrom: 0, game: 0, chip: crtChipROM, windows: []int{0x8000, 0xA000}, maxBanks: 64},
+	"easyflash": crtType{hwType: 32, exrom: 1, game: 0, chip: crtChipFlash, windows: []int{0x8000, 0xA000, 0xE000}, maxBanks: 64},
+}
+
+// formatCRT writes a cartridge image where each bank of the program
+// goes into the CHIP packets for the windows of memory it uses
+func formatCRT(asm *assembly, opts outputOptions) ([]byte, error) {
+
+	ct, found := crtTypes[opts.crtType]
+	if !found {
+		return nil, fmt.Errorf("Unknown cartridge type %s", opts.crtType)
+	}
+
+	buffer := new(bytes.Buffer)
+
+	// header
+	name := make([]byte, 32)
+	copy(name, strings.ToUpper(opts.crtName))
+	buffer.WriteString("C64 CARTRIDGE   ")
+	for _, v := range []interface{}{uint32(crtHeaderLen), uint16(crtVersion), ct.hwType} {
+		if bWriteErr := binary.Write(buffer, binary.BigEndian, v); bWriteErr != nil {
+			return nil, bWriteErr
+		}
+	}
+	buffer.Write([]byte{ct.exrom, ct.game, 0, 0, 0, 0, 0, 0})
+	buffer.Write(name)
+
+	for _, b := range asm.banks {
+
+		if b.bank >= ct.maxBanks {
+			return nil, fmt.Errorf("Bank %d is out of range for a %s cartridge", b.bank, opts.crtType)
+		}
+
+		chipSize := crtWindowSize
+		if ct.chipSize != 0 {
+			chipSize = ct.chipSize
+		}
+
+		// check all the data lands in the windows
+		chunks := chunksOf(b.start, b.segments, b.image)
+		used := map[int]bool{}
+		for _, c := range chunks {
+			covered := 0
+			for _, w := range ct.windows {
+				if from, to := crtOverlap(c, w, chipSize); to > from {
+					covered += to - from
+					used[w] = true
+				}
+			}
+			if covered != len(c.data) {
+				return nil, fmt.Errorf(
+					"Segment at $%04x in bank %d does not fit in the ROM of a %s cartridge",
+					c.addr, b.bank, opts.crtType)
+			}
+		}
+
+		for _, w := range ct.windows {
+			if !used[w] {
+				continue
+			}
+
+			rom := bytes.Repeat([]byte{crtFill}, chipSize)
+			for _, c := range chunks {
+				if from, to := crtOverlap(c, w, chipSize); to > from {
+					copy(rom[from-w:to-w], c.data[from-c.addr:to-c.addr])
+				}
+			}
+
+			// EasyFlash ROMH banks show up at $E000 in
+			// Ultimax mode but are always stored at $A000
+			load := w
+			if opts.crtType == "easyflash" && w == 0xE000 {
+				if used[0xA000] {
+					return nil, fmt.Errorf("Bank %d uses both $A000 and $E000, they are the same ROMH chip", b.bank)
+				}
+				load = 0xA000
+			}
+
+			buffer.WriteString("CHIP")
+			for _, v := range []interface{}{uint32(crtChipHeader + chipSize), ct.chip, uint16(b.bank), uint16(load), uint16(chipSize)} {
+				if bWriteErr := binary.Write(buffer, binary.BigEndian, v); bWriteErr != nil {
+					return nil, bWriteErr
+				}
+			}
+			buffer.Write(rom)
+		}
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// crtOverlap returns the range of addresses
+// of a chunk that fall into a window
+func crtOverlap(c chunk, window, size int) (int, int) {
+	from, to := c.addr, c.addr+len(c.data)
+	if from < window {
+		from = window
+	}
+	if to > window+size {
+		to = window + size
+	}
+	return from, to
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// D64 images are a sector by sector dump of a 1541 disk, 35 tracks
+// with 17 to 21 sectors of 256 bytes each. Track 18 holds the BAM
+// (Block Availability Map) in sector 0 and the directory starting
+// in sector 1. Files are chains of sectors where the first two
+// bytes point to the next track/sector of the file.
+
+const (
+	d64Tracks       = 35
+	d64SectorSize   = 256
+	d64DirTrack     = 18
+	d64DirEntrySize = 32
+	d64FileNameLen  = 16
+	d64Padding      = 0xA0
+	d64TypePRG      = 0x82 // PRG file, closed
+	d64FileInterlv  = 10
+	d64DirInterlv   = 3
+)
+
+type d64Image struct {
+	data []byte
+}
+
+// diskFile is a file to be added to a disk image
+type diskFile struct {
+	name string
+	path string
+}
+
+// writeD64 creates a disk image with the program
+// and any other additional file on it
+func writeD64(filename, diskName, diskID, progName string, program []byte, files []diskFile) error {
+	d := newD64Image(diskName, diskID)
+	if err := d.addFile(progName, program); err != nil {
+		return err
+	}
+	for _, f := range files {
+		data, readErr := ioutil.ReadFile(f.path)
+		if readErr != nil {
+			return readErr
+		}
+		if err := d.addFile(f.name, data); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(filename, d.data, 0644)
+}
+
+func d64SectorsPerTrack(track int) int {
+	switch {
+	case track <= 17:
+		return 21
+	case track <= 24:
+		return 19
+	case track <= 30:
+		return 18
+	default:
+		return 17
+	}
+}
+
+func d64Offset(track, sector int) int {
+	offset := 0
+	for t := 1; t < track; t++ {
+		offset += d64SectorsPerTrack(t)
+	}
+	return (offset + sector) * d64SectorSize
+}
+
+func newD64Image(name, id string) *d64Image {
+
+	size := d64Offset(d64Tracks+1, 0)
+	d := &d64Image{data: make([]byte, size)}
+
+	// all sectors start free
+	for t := 1; t <= d64Tracks; t++ {
+		for s := 0; s < d64SectorsPerTrack(t); s++ {
+			d.free(t, s)
+		}
+	}
+
+	bam := d64Offset(d64DirTrack, 0)
+
+	// first directory sector and DOS version
+	d.data[bam+0] = d64DirTrack
+	d.data[bam+1] = 1
+	d.data[bam+2] = 'A'
+
+	// disk name, id and DOS type
+	for i := 0x90; i <= 0xAA; i++ {
+		d.data[bam+i] = d64Padding
+	}
+	copy(d.data[bam+0x90:bam+0x90+d64FileNameLen], petsciiFileName(name, d64FileNameLen))
+	copy(d.data[bam+0xA2:bam+0xA4], petsciiFileName(id, 2))
+	d.data[bam+0xA5] = '2'
+	d.data[bam+0xA6] = 'A'
+
+	// BAM and the empty first directory sector
+	d.allocate(d64DirTrack, 0)
+	d.allocate(d64DirTrack, 1)
+	dir := d64Offset(d64DirTrack, 1)
+	d.data[dir+1] = 0xFF
+
+	return d
+}
+
+// -----------------------------------------------------------------------------
+// BAM:
+// -----------------------------------------------------------------------------
+
+func (d *d64Image) bamEntry(track int) int {
+	return d64Offset(d64DirTrack, 0) + 4*track
+}
+
+func (d *d64Image) isFree(track, sector int) bool {
+	e := d.bamEntry(track)
+	return d.data[e+1+sector/8]&(1<<uint(sector%8)) != 0
+}
+
+func (d *d64Image) free(track, sector int) {
+	if d.isFree(track, sector) {
+		return
+	}
+	e := d.bamEntry(track)
+	d.data[e+1+sector/8] |= 1 << uint(sector%8)
+	d.data[e]++
+}
+
+func (d *d64Image) allocate(track, sector int) {
+	if !d.isFree(track, sector) {
+		return
+	}
+	e := d.bamEntry(track)
+	d.data[e+1+sector/8] &^= 1 << uint(sector%8)
+	d.data[e]--
+}
+
+// freeSectors is the number of free sectors
+// ("blocks free") not counting the directory track
+func (d *d64Image) freeSectors() int {
+	free := 0
+	for t := 1; t <= d64Tracks; t++ {
+		if t != d64DirTrack {
+			free += int(d.data[d.bamEntry(t)])
+		}
+	}
+	return free
+}
+
+// nextFreeSector finds a free sector on a track, starting
+// after the given one plus interleave. -1 if the track is full.
+func (d *d64Image) nextFreeSector(track, after, interleave int) int {
+	n := d64SectorsPerTrack(track)
+	start := 0
+	if after >= 0 {
+		start = (after + interleave) % n
+	}
+	for i := 0; i < n; i++ {
+		if s := (start + i) % n; d.isFree(track, s) {
+			return s
+		}
+	}
+	return -1
+}
+
+// -----------------------------------------------------------------------------
+// Files:
+// -----------------------------------------------------------------------------
+
+// addFile writes the data as a PRG file, like the 1541 does it
+// starts at the tracks next to the directory and moves outwards
+func (d *d64Image) addFile(name string, data []byte) error {
+
+	type ts struct{ track, sector int }
+
+	nsectors := (len(data) + d64SectorSize - 3) / (d64SectorSize - 2)
+	if nsectors == 0 {
+		nsectors = 1
+	}
+	if nsectors > d.freeSectors() {
+		return fmt.Errorf("Disk full, cannot write %s (%d blocks)", name, nsectors)
+	}
+
+	tracks := []int{}
+	for t := d64DirTrack - 1; t >= 1; t-- {
+		tracks = append(tracks, t)
+	}
+	for t := d64DirTrack + 1; t <= d64Tracks; t++ {
+		tracks = append(tracks, t)
+	}
+
+	chain := []ts{}
+	sector := -1
+	for _, t := range tracks {
+		for len(chain) < nsectors {
+			if sector = d.nextFreeSector(t, sector, d64FileInterlv); sector < 0 {
+				break
+			}
+			d.allocate(t, sector)
+			chain = append(chain, ts{t, sector})
+		}
+		if len(chain) == nsectors {
+			break
+		}
+	}
+
+	for i, c := range chain {
+		offset := d64Offset(c.track, c.sector)
+		chunk := data[i*(d64SectorSize-2):]
+		if len(chunk) > d64SectorSize-2 {
+			chunk = chunk[:d64SectorSize-2]
+		}
+		if i < len(chain)-1 {
+			d.data[offset] = byte(chain[i+1].track)
+			d.data[offset+1] = byte(chain[i+1].sector)
+		} else {
+			// last sector: no next track and
+			// the index of the last byte used
+			d.data[offset] = 0
+			d.data[offset+1] = byte(len(chunk) + 1)
+		}
+		copy(d.data[offset+2:], chunk)
+	}
+
+	entry, dirErr := d.newDirEntry()
+	if dirErr != nil {
+		return dirErr
+	}
+	d.data[entry+2] = d64TypePRG
+	d.data[entry+3] = byte(chain[0].track)
+	d.data[entry+4] = byte(chain[0].sector)
+	copy(d.data[entry+5:entry+5+d64FileNameLen], petsciiFileName(name, d64FileNameLen))
+	d.data[entry+0x1E] = byte(nsectors)
+	d.data[entry+0x1F] = byte(nsectors >> 8)
+
+	return nil
+}
+
+// newDirEntry returns the offset of the first unused directory
+// entry, extending the directory with a new sector if needed
+func (d *d64Image) newDirEntry() (int, error) {
+	sector := 1
+	for {
+		dir := d64Offset(d64DirTrack, sector)
+		for e := 0; e < d64SectorSize; e += d64DirEntrySize {
+			if d.data[dir+e+2] == 0 {
+				return dir + e, nil
+			}
+		}
+		if d.data[dir] != 0 {
+			sector = int(d.data[dir+1])
+			continue
+		}
+
+		next := d.nextFreeSector(d64DirTrack, sector, d64DirInterlv)
+		if next < 0 {
+			return 0, fmt.Errorf("Directory full")
+		}
+		d.allocate(d64DirTrack, next)
+		d.data[dir] = d64DirTrack
+		d.data[dir+1] = byte(next)
+		nextDir := d64Offset(d64DirTrack, next)
+		d.data[nextDir+1] = 0xFF
+		sector = next
+	}
+}
+
+// petsciiFileName converts the name to upper case PETSCII
+// and pads it with shifted spaces as in a disk directory
+func petsciiFileName(name string, size int) []byte {
+	b := []byte(strings.ToUpper(name))
+	if len(b) > size {
+		b = b[:size]
+	}
+	for len(b) < size {
+		b = append(b, d64Padding)
+	}
+	return b
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestD64AddFile(t *testing.T) {
+	tests := []struct {
+		size   int
+		blocks int
+	}{{
+		0, 1,
+	}, {
+		254, 1,
+	}, {
+		255, 2,
+	}, {
+		47448, 187,
+	}}
+
+	d := newD64Image("test disk", "ab")
+	free := d.freeSectors()
+	if free != 664 {
+		t.Fatalf("expected 664 blocks free on a new image but got %d", free)
+	}
+
+	for i, test := range tests {
+		data := make([]byte, test.size)
+		for b := range data {
+			data[b] = byte(b + i)
+		}
+		if err := d.addFile("file", data); err != nil {
+			t.Fatal(err.Error())
+		}
+		free -= test.blocks
+		if d.freeSectors() != free {
+			t.Errorf("size %d: expected %d blocks free but got %d", test.size, free, d.freeSectors())
+		}
+
+		// follow the chain from the directory entry
+		entry := d64Offset(d64DirTrack, 1) + i*d64DirEntrySize
+		track, sector := int(d.data[entry+3]), int(d.data[entry+4])
+		read := []byte{}
+		for track != 0 {
+			offset := d64Offset(track, sector)
+			if d.data[offset] == 0 {
+				read = append(read, d.data[offset+2:offset+int(d.data[offset+1])+1]...)
+			} else {
+				read = append(read, d.data[offset+2:offset+d64SectorSize]...)
+			}
+			track, sector = int(d.data[offset]), int(d.data[offset+1])
+		}
+		if !bytes.Equal(read, data) {
+			t.Errorf("size %d: file read back differs, got %d bytes", test.size, len(read))
+		}
+	}
+}
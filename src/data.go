@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Data directives take lists of strings, numbers, labels and formulas
+// separated by commas, mixed in any order:
+//
+//	prompt	.text "PRESS SPACE", 13, 0
+//	table	dfb "AB", $00, count, [<b handler]
+//
+// Strings are written with the encoding of the directive, the one
+// chosen with `.encoding scr`, `.encoding petscii` or `.encoding ascii`
+// for `.text` and DFB (screen codes unless changed), and every other
+// item is a byte, resolved once all the labels are known. The string
+// variants use the chosen encoding too:
+//
+//	.cstring "GAME OVER"	ends with a 0
+//	.pstring "GAME OVER"	starts with the number of bytes after it
+//	.hstring "GAME OVER"	sets the high bit of the last byte
+
+const (
+	stringEndBit   = 0x80
+	maxPStringSize = 0xFF
+)
+
+// dataByte is a byte of a data list, either known
+// already or a formula to resolve after the layout
+type dataByte struct {
+	value byte
+	expr  string
+}
+
+// isData tells if the directive writes a list of data
+func isData(mnemonic string) bool {
+	switch mnemonic {
+	case "DFB", ".CSTRING", ".PSTRING", ".HSTRING":
+		return true
+	}
+	return isText(mnemonic)
+}
+
+// readDataList splits the list of a data directive, checking
+// the strings and the values that are already known
+func readDataList(opc, rawoper string) ([]string, error) {
+	// a single word without quotes is the text itself,
+	// like .text HELLO was before it took lists
+	if isText(opc) && isBareWord(rawoper) {
+		return []string{"\"" + rawoper + "\""}, nil
+	}
+
+	items := []string{}
+	for _, item := range splitArgs(rawoper) {
+		if item == "" {
+			continue
+		}
+
+		if item[0] == '"' {
+			if end, endErr := scanString(item, 0); endErr != nil || end != len(item) {
+				return nil, fmt.Errorf("Syntax error in %s on %s instruction", item, opc)
+			} else if !utf8.ValidString(item) {
+				return nil, fmt.Errorf("%s is not a valid UTF-8 text", item)
+			}
+			items = append(items, item)
+			continue
+		}
+
+		value, label, valueErr := readAddress(item)
+		if isText(opc) && label != "" && label[0] != '[' && strings.ContainsAny(label, " \t") {
+			return nil, fmt.Errorf("Syntax error in %s on %s instruction, text must be quoted like \"%s\"", item, opc, item)
+		} else if valueErr != nil || (label != "" && label[0] != '[' && strings.ContainsAny(label, " \t")) {
+			return nil, fmt.Errorf("Syntax error in %s on %s instruction", item, opc)
+		} else if label == "" && value > 0xFF {
+			return nil,
+				fmt.Errorf(
+					"Value %s is out of range. Enter only values valid for a byte's range", item)
+		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("No valid data found for %s instruction", opc)
+	}
+	return items, nil
+}
+
+// isBareWord tells if the operand is one word that reads as a label,
+// with no quotes, commas, formulas or numbers
+func isBareWord(rawoper string) bool {
+	if rawoper == "" || strings.ContainsAny(rawoper, "\",[ \t") {
+		return false
+	}
+	_, label, err := readAddress(rawoper)
+	return err == nil && label == rawoper
+}
+
+// dataBytes encodes the strings of the list and
+// adds the end or length of the string variants
+func (e *textEncoder) dataBytes(mnemonic string, items []string) ([]dataByte, error) {
+	data := []dataByte{}
+	for _, item := range items {
+		if item[0] == '"' {
+			text, err := e.encode(mnemonic, []byte(item[1:len(item)-1]))
+			if err != nil {
+				return nil, err
+			}
+			for _, b := range text {
+				data = append(data, dataByte{value: b})
+			}
+			continue
+		}
+
+		if value, label, _ := readAddress(item); label != "" {
+			data = append(data, dataByte{expr: label})
+		} else {
+			data = append(data, dataByte{value: byte(value)})
+		}
+	}
+
+	switch mnemonic {
+	case ".CSTRING":
+		data = append(data, dataByte{})
+	case ".PSTRING":
+		if len(data) > maxPStringSize {
+			return nil, fmt.Errorf("A .pstring can have up to %d bytes, found %d", maxPStringSize, len(data))
+		}
+		data = append([]dataByte{{value: byte(len(data))}}, data...)
+	case ".HSTRING":
+		if len(data) == 0 {
+			return nil, fmt.Errorf("A .hstring needs at least one byte")
+		}
+		last := &data[len(data)-1]
+		if last.expr != "" {
+			last.expr = fmt.Sprintf("[| %s $%02x]", last.expr, stringEndBit)
+		} else {
+			last.value |= stringEndBit
+		}
+	}
+	return data, nil
+}
+
+// readEncoding checks the encoding of an .encoding line
+func readEncoding(rawoper string) ([]string, error) {
+	switch encoding := strings.ToLower(rawoper); encoding {
+	case "scr", "petscii", "ascii":
+		return []string{"." + strings.ToUpper(encoding)}, nil
+	}
+	return nil, fmt.Errorf("Unknown encoding %s, expecting scr, petscii or ascii", rawoper)
+}
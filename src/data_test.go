@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDataLists(t *testing.T) {
+	defer resetSymbols()
+
+	var tests = []struct {
+		lines    []string
+		expected []byte
+		err      string
+	}{
+		{[]string{".text \"PRESS SPACE\", 13, 0"}, append([]byte("PRESS SPACE"), 13, 0), ""},
+		{[]string{"dfb \"AB\", $00"}, []byte{0x41, 0x42, 0x00}, ""},
+		{[]string{"dfb 1, 2 ,3"}, []byte{1, 2, 3}, ""},
+		{[]string{"dfb \"a,b\", \"\\\"\""}, []byte{0x01, 0x2C, 0x02, 0x22}, ""},
+		// labels and formulas, also before they are defined
+		{[]string{"dfb count, [<b table], [>b table], [+ count 1]", "table: rts", "count = 3"}, []byte{3, 0x04, 0x20, 4, 0x60}, ""},
+		// the encoding for .text and dfb
+		{[]string{".encoding petscii", ".text \"ab\"", "dfb \"ab\"", ".scr \"ab\"", ".encoding scr", ".text \"ab\""},
+			[]byte{0x41, 0x42, 0x41, 0x42, 0x01, 0x02, 0x01, 0x02}, ""},
+		{[]string{".cstring \"AB\", 13"}, []byte{0x41, 0x42, 13, 0}, ""},
+		{[]string{".pstring \"AB\", 13"}, []byte{3, 0x41, 0x42, 13}, ""},
+		{[]string{".hstring \"AB\""}, []byte{0x41, 0xC2}, ""},
+		{[]string{".hstring \"AB\", last", "last = 1"}, []byte{0x41, 0x42, 0x81}, ""},
+		{[]string{".encoding ascii", ".cstring \"ok\"", ".pstring \"\""}, []byte{0x6F, 0x6B, 0, 0}, ""},
+		// a single word without quotes is text, lists need quotes
+		{[]string{".text HELLO"}, []byte("HELLO"), ""},
+		{[]string{".encoding ascii", ".text ok", ".text \"ok\""}, []byte("okok"), ""},
+		{[]string{".text HELLO WORLD"}, nil, ":2:Syntax error in HELLO WORLD on .TEXT instruction, text must be quoted like \"HELLO WORLD\""},
+		{[]string{".petscii \"A\", HI THERE"}, nil, ":2:Syntax error in HI THERE on .PETSCII instruction, text must be quoted like \"HI THERE\""},
+		{[]string{"dfb big", "big = $100"}, nil, ":2:Value $100 of big doesn't fit in a byte"},
+		{[]string{".hstring \"\""}, nil, ":2:A .hstring needs at least one byte"},
+		{[]string{".pstring \"" + strings.Repeat("x", 256) + "\""}, nil, ":2:A .pstring can have up to 255 bytes, found 256"},
+	}
+
+	for i, test := range tests {
+		asm, err := assembleLines(t, append([]string{"\t.org $2000"}, test.lines...))
+
+		if test.err != "" {
+			if err == nil || !strings.HasSuffix(err.Error(), test.err) {
+				t.Errorf("test %d: expected error %s but got %v", i, test.err, err)
+			}
+		} else if err != nil {
+			t.Errorf("test %d: unexpected error %s", i, err.Error())
+		} else if !bytes.Equal(asm.program[2:], test.expected) {
+			t.Errorf("test %d: expected % x but got % x", i, test.expected, asm.program[2:])
+		}
+	}
+}
+
+func TestDataListSyntax(t *testing.T) {
+	var tests = []struct {
+		line string
+		err  string
+	}{
+		{"dfb 1,2,3", ""},
+		{"msg .text \"HI\", 0", ""},
+		{"dfb 256", "Value 256 is out of range. Enter only values valid for a byte's range"},
+		{"dfb \"AB\" 0", "Syntax error in \"AB\" 0 on DFB instruction"},
+		{"dfb 1 2", "Syntax error in 1 2 on DFB instruction"},
+		{"dfb ,", "No valid data found for DFB instruction"},
+		{".encoding ebcdic", "Unknown encoding ebcdic, expecting scr, petscii or ascii"},
+	}
+	for _, test := range tests {
+		_, err := tokenizer{}.tokenize(test.line)
+		if test.err == "" && err != nil {
+			t.Errorf("%s: unexpected error %s", test.line, err.Error())
+		} else if test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("%s: expected error %q but got %v", test.line, test.err, err)
+		}
+	}
+}
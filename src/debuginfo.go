@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Debug info is written in the XML format that KickAssembler
+// dumps with its `-debugdump` option, which is understood by
+// C64 Debugger, Retro Debugger and the VICE based IDEs:
+//
+// <C64debugger version="1.0">
+//   <Sources values="INDEX,FILE">
+//     0,/path/to/index.asm
+//   </Sources>
+//   <Segment name="Default" dest="" values="START,END,FILE_IDX,LINE1,COL1,LINE2,COL2">
+//     <Block name="main">
+//       $c000,$c002,0,12,2,12,10
+//     </Block>
+//   </Segment>
+//   <Labels values="SEGMENT,ADDRESS,NAME">
+//     Default,$c000,main
+//   </Labels>
+//   <Breakpoints values="SEGMENT,ADDRESS,ARGUMENT">
+//     Default,$c004,A == $00
+//   </Breakpoints>
+//   <Watchpoints values="SEGMENT,ADDRESS1,ADDRESS2,ARGUMENT">
+//     Default,$d020,$d020,store
+//   </Watchpoints>
+// </C64debugger>
+//
+// All the code goes into a single segment and each `.org`
+// starts a new block.
+
+const debugInfoSegment = "Default"
+
+type debugRange struct {
+	start int
+	end   int
+	loc   sourceLocation
+}
+
+type debugBlock struct {
+	name   string
+	start  int
+	ranges []debugRange
+}
+
+func writeDebugInfo(filename string, asm *assembly) error {
+
+	sources := []string{}
+	sourceIdx := map[string]int{}
+
+	for _, seg := range asm.segments {
+		for _, al := range seg.partiallyAssembled {
+			if _, found := sourceIdx[al.data.loc.file]; found || al.data.loc.file == "" {
+				continue
+			}
+			sourceIdx[al.data.loc.file] = len(sources)
+			sources = append(sources, al.data.loc.file)
+		}
+	}
+
+	buffer := new(bytes.Buffer)
+	buffer.WriteString("<C64debugger version=\"1.0\">\n")
+
+	buffer.WriteString("\t<Sources values=\"INDEX,FILE\">\n")
+	for i, src := range sources {
+		if abs, absErr := filepath.Abs(src); absErr == nil {
+			src = abs
+		}
+		fmt.Fprintf(buffer, "\t\t%d,%s\n", i, escapeDebugInfo(src))
+	}
+	buffer.WriteString("\t</Sources>\n")
+
+	fmt.Fprintf(
+		buffer,
+		"\t<Segment name=\"%s\" dest=\"\" values=\"START,END,FILE_IDX,LINE1,COL1,LINE2,COL2\">\n",
+		debugInfoSegment)
+	for _, b := range debugBlocks(asm.segments) {
+		fmt.Fprintf(buffer, "\t\t<Block name=\"%s\">\n", escapeDebugInfo(b.name))
+		for _, r := range b.ranges {
+			fmt.Fprintf(
+				buffer,
+				"\t\t\t$%04x,$%04x,%d,%d,%d,%d,%d\n",
+				r.start, r.end, sourceIdx[r.loc.file], r.loc.line, r.loc.col1, r.loc.line, r.loc.col2)
+		}
+		buffer.WriteString("\t\t</Block>\n")
+	}
+	buffer.WriteString("\t</Segment>\n")
+
+	buffer.WriteString("\t<Labels values=\"SEGMENT,ADDRESS,NAME\">\n")
+	for _, sym := range sortedSymbols() {
+		fmt.Fprintf(buffer, "\t\t%s,$%04x,%s\n", debugInfoSegment, symbols[sym], escapeDebugInfo(sym))
+	}
+	buffer.WriteString("\t</Labels>\n")
+
+	breakpoints := new(bytes.Buffer)
+	watchpoints := new(bytes.Buffer)
+	for _, cp := range asm.checkpoints {
+		rcp, err := resolveCheckpoint(cp)
+		if err != nil {
+			return fmt.Errorf("%s:%d:%s", cp.line.loc.file, cp.line.loc.line, err.Error())
+		}
+		if !rcp.watch {
+			fmt.Fprintf(
+				breakpoints, "\t\t%s,$%04x,%s\n",
+				debugInfoSegment, rcp.start, escapeDebugInfo(rcp.cond))
+		} else {
+			fmt.Fprintf(
+				watchpoints, "\t\t%s,$%04x,$%04x,%s\n",
+				debugInfoSegment, rcp.start, rcp.end, escapeDebugInfo(rcp.access))
+		}
+	}
+	buffer.WriteString("\t<Breakpoints values=\"SEGMENT,ADDRESS,ARGUMENT\">\n")
+	buffer.Write(breakpoints.Bytes())
+	buffer.WriteString("\t</Breakpoints>\n")
+	buffer.WriteString("\t<Watchpoints values=\"SEGMENT,ADDRESS1,ADDRESS2,ARGUMENT\">\n")
+	buffer.Write(watchpoints.Bytes())
+	buffer.WriteString("\t</Watchpoints>\n")
+
+	buffer.WriteString("</C64debugger>\n")
+
+	return ioutil.WriteFile(filename, buffer.Bytes(), 0644)
+}
+
+// debugBlocks maps the address ranges of each segment back to the
+// source lines, consecutive bytes coming from the same source line
+// (like the ones of a DFB or a ./bin) are merged in a single range
+func debugBlocks(segs []segment) []debugBlock {
+	blocks := []debugBlock{}
+
+	for _, seg := range segs {
+		if len(seg.partiallyAssembled) == 0 {
+			continue
+		}
+
+		first := seg.partiallyAssembled[0]
+		b := debugBlock{start: first.addr}
+		if first.data.label != "" {
+			b.name = strings.TrimSuffix(first.data.label, ":")
+		} else {
+			b.name = fmt.Sprintf("$%04x", first.addr)
+		}
+
+		for _, al := range seg.partiallyAssembled {
+			if al.data.loc.file == "" {
+				continue
+			}
+			end := al.addr + al.size() - 1
+			if last := len(b.ranges) - 1; last >= 0 &&
+				b.ranges[last].loc == al.data.loc &&
+				b.ranges[last].end+1 == al.addr {
+				b.ranges[last].end = end
+				continue
+			}
+			b.ranges = append(b.ranges, debugRange{start: al.addr, end: end, loc: al.data.loc})
+		}
+
+		blocks = append(blocks, b)
+	}
+
+	sort.SliceStable(blocks, func(i, j int) bool {
+		return blocks[i].start < blocks[j].start
+	})
+	return blocks
+}
+
+// sortedSymbols returns the names in the symbols
+// table sorted by their value and then by name
+func sortedSymbols() []string {
+	names := []string{}
+	for sym := range symbols {
+		names = append(names, sym)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if symbols[names[i]] != symbols[names[j]] {
+			return symbols[names[i]] < symbols[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+func escapeDebugInfo(s string) string {
+	buffer := new(bytes.Buffer)
+	xml.EscapeText(buffer, []byte(s))
+	return buffer.String()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteDebugInfo(t *testing.T) {
+	defer resetSymbols()
+
+	var tests = []struct {
+		files    map[string]string // main.asm and its includes
+		expected string            // {dir} stands for the sources dir
+	}{
+		{
+			map[string]string{
+				"main.asm": "\t.org $c000\nmain:\tlda #$00\n\tjsr print\n\tdfb 1,2,3\n\t.org $c100\ntable:\tlda #4\n./include io.asm\n",
+				"io.asm":   "print:\tsta $d020\n\trts\n",
+			},
+			`<C64debugger version="1.0">
+	<Sources values="INDEX,FILE">
+		0,{dir}/main.asm
+		1,{dir}/io.asm
+	</Sources>
+	<Segment name="Default" dest="" values="START,END,FILE_IDX,LINE1,COL1,LINE2,COL2">
+		<Block name="main">
+			$c000,$c001,0,2,1,2,14
+			$c002,$c004,0,3,2,3,10
+			$c005,$c007,0,4,2,4,10
+		</Block>
+		<Block name="table">
+			$c100,$c101,0,6,1,6,13
+			$c102,$c104,1,1,1,1,16
+			$c105,$c105,1,2,2,2,4
+		</Block>
+	</Segment>
+	<Labels values="SEGMENT,ADDRESS,NAME">
+		Default,$c000,main
+		Default,$c100,table
+		Default,$c102,print
+	</Labels>
+	<Breakpoints values="SEGMENT,ADDRESS,ARGUMENT">
+	</Breakpoints>
+	<Watchpoints values="SEGMENT,ADDRESS1,ADDRESS2,ARGUMENT">
+	</Watchpoints>
+</C64debugger>
+`,
+		},
+		{
+			map[string]string{
+				"main.asm": "\t.org $0810\n\t.break if [< x 2]\nloop:\tinx\n\t.break\n\t.watch store $d020\n\tjmp loop\n",
+			},
+			`<C64debugger version="1.0">
+	<Sources values="INDEX,FILE">
+		0,{dir}/main.asm
+	</Sources>
+	<Segment name="Default" dest="" values="START,END,FILE_IDX,LINE1,COL1,LINE2,COL2">
+		<Block name="loop">
+			$0810,$0810,0,3,1,3,9
+			$0811,$0813,0,6,2,6,9
+		</Block>
+	</Segment>
+	<Labels values="SEGMENT,ADDRESS,NAME">
+		Default,$0810,loop
+	</Labels>
+	<Breakpoints values="SEGMENT,ADDRESS,ARGUMENT">
+		Default,$0810,X &lt; $02
+		Default,$0811,
+	</Breakpoints>
+	<Watchpoints values="SEGMENT,ADDRESS1,ADDRESS2,ARGUMENT">
+		Default,$d020,$d020,store
+	</Watchpoints>
+</C64debugger>
+`,
+		},
+	}
+
+	for i, test := range tests {
+		dir := t.TempDir()
+		for name, source := range test.files {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(source), 0644); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+		asm := assembleTestFile(t, filepath.Join(dir, "main.asm"))
+
+		dbg := filepath.Join(dir, "main.dbg")
+		if err := writeDebugInfo(dbg, asm); err != nil {
+			t.Fatal(err.Error())
+		}
+		actual, _ := ioutil.ReadFile(dbg)
+		if expected := strings.ReplaceAll(test.expected, "{dir}", dir); string(actual) != expected {
+			t.Errorf("test %d: expected\n%s\nbut got\n%s", i, expected, actual)
+		}
+	}
+}
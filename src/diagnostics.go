@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Checks and messages written in the sources, evaluated once the whole
+// program is laid out so they can use any label:
+//
+//	.assert [< music_end $2000], "music must end before $2000"
+//	.warning "still using the placeholder font"
+//	.print "free bytes:", [- $2000 music_end]
+//	.error "not ready yet"
+//
+// A failed .assert or an .error stop the build with the location.
+
+// message is a note for the user from .warning or .print
+type message struct {
+	text    string
+	warning bool
+}
+
+// isDiagnostic tells if the directive is checked after the layout
+func isDiagnostic(mnemonic string) bool {
+	switch mnemonic {
+	case ".ASSERT", ".ERROR", ".WARNING", ".PRINT":
+		return true
+	}
+	return false
+}
+
+// checkDiagnostics evaluates the directives in order, returning
+// the messages written or the error of the first failed check
+func checkDiagnostics(lines []*tokenizedLine) ([]message, error) {
+	messages := []message{}
+
+	for _, l := range lines {
+		at := fmt.Sprintf("%s:%d", l.loc.file, l.loc.line)
+		args := l.opr.args
+
+		switch l.opc.mnemonic {
+		case ".ASSERT":
+			v, err := resolveExpression(args[0])
+			if err != nil {
+				return nil, fmt.Errorf("%s:%s", at, err.Error())
+			} else if v == 0 {
+				reason := args[0]
+				if args[1] != "" {
+					reason = args[1]
+				}
+				return nil, fmt.Errorf("%s:Assertion failed: %s", at, reason)
+			}
+		case ".ERROR":
+			return nil, fmt.Errorf("%s:%s", at, args[0])
+		case ".WARNING":
+			messages = append(messages, message{text: fmt.Sprintf("%s:%s", at, args[0]), warning: true})
+		case ".PRINT":
+			parts := []string{}
+			for _, arg := range args {
+				if text, quoted, err := readQuoted(arg); err != nil {
+					return nil, fmt.Errorf("%s:%s", at, err.Error())
+				} else if quoted {
+					parts = append(parts, text)
+					continue
+				}
+				v, err := resolveExpression(arg)
+				if err != nil {
+					return nil, fmt.Errorf("%s:%s", at, err.Error())
+				}
+				parts = append(parts, fmt.Sprintf("$%04x (%d)", v, v))
+			}
+			messages = append(messages, message{text: fmt.Sprintf("%s:%s", at, strings.Join(parts, " "))})
+		}
+	}
+	return messages, nil
+}
+
+// printMessages writes the warnings to the
+// standard error and the rest to the output
+func printMessages(messages []message) {
+	for _, m := range messages {
+		if m.warning {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", m.text)
+		} else {
+			fmt.Println(m.text)
+		}
+	}
+}
+
+// splitArgs splits the arguments of a directive on the
+// commas that are not inside a quoted text or a formula
+func splitArgs(rawoper string) []string {
+	args := []string{}
+	start, depth, quoted := 0, 0, false
+	for i := 0; i < len(rawoper); i++ {
+		switch c := rawoper[i]; {
+		case c == '"':
+			quoted = !quoted
+		case c == '\\' && quoted:
+			i++
+		case quoted:
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == ',' && depth == 0:
+			args = append(args, strings.TrimSpace(rawoper[start:i]))
+			start = i + 1
+		}
+	}
+	return append(args, strings.TrimSpace(rawoper[start:]))
+}
+
+// readQuoted returns the text between double quotes
+func readQuoted(s string) (string, bool, error) {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return "", false, nil
+	}
+	text, err := unescape(s[1 : len(s)-1])
+	return text, true, err
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiagnostics(t *testing.T) {
+	defer resetSymbols()
+
+	var tests = []struct {
+		lines    []string
+		messages []message
+		err      string
+	}{
+		{
+			[]string{".assert [= [>b table] [>b table_end]], \"table must not cross a page\""},
+			[]message{},
+			"",
+		},
+		{
+			[]string{".assert [< table_end $c000], \"table must end before $c000\""},
+			nil,
+			":6:Assertion failed: table must end before $c000",
+		},
+		{
+			[]string{".assert [= table 0]"},
+			nil,
+			":6:Assertion failed: [= table 0]",
+		},
+		{
+			[]string{".warning \"not final, yet\"", ".print \"table size:\", [- table_end table]"},
+			[]message{{":6:not final, yet", true}, {":7:table size: $0003 (3)", false}},
+			"",
+		},
+		{
+			[]string{".print start, \"and\", table"},
+			[]message{{":6:$c000 (49152) and $c003 (49155)", false}},
+			"",
+		},
+		{
+			[]string{".error \"not ready\""},
+			nil,
+			":6:not ready",
+		},
+		{
+			[]string{".print missing"},
+			nil,
+			":6:Undefined symbol missing",
+		},
+	}
+
+	for i, test := range tests {
+		asm, err := assembleLines(t, append([]string{
+			"\t.org $c000",
+			"start:\tlda #1",
+			"\trts",
+			"table\tdfb 1,2,3",
+			"table_end:\tnop",
+		}, test.lines...))
+
+		if test.err != "" {
+			if err == nil || !strings.HasSuffix(err.Error(), test.err) {
+				t.Errorf("test %d: expected error %s but got %v", i, test.err, err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("test %d: unexpected error %s", i, err.Error())
+			continue
+		}
+
+		if len(asm.messages) != len(test.messages) {
+			t.Errorf("test %d: expected messages %v but got %v", i, test.messages, asm.messages)
+			continue
+		}
+		for j, m := range asm.messages {
+			if m.warning != test.messages[j].warning || !strings.HasSuffix(m.text, test.messages[j].text) {
+				t.Errorf("test %d: expected messages %v but got %v", i, test.messages, asm.messages)
+				break
+			}
+		}
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	var tests = []struct {
+		rawoper string
+		args    []string
+	}{
+		{`a`, []string{"a"}},
+		{`[= a b], "a, b"`, []string{"[= a b]", `"a, b"`}},
+		{` "x" ,[+ a [* 2 b]] , c`, []string{`"x"`, "[+ a [* 2 b]]", "c"}},
+	}
+	for _, test := range tests {
+		if args := splitArgs(test.rawoper); !reflect.DeepEqual(args, test.args) {
+			t.Errorf("expected %q for %s but got %q", test.args, test.rawoper, args)
+		}
+	}
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The disassembler turns a binary back into xbbasm sources that
+// assemble to exactly the same bytes. Whatever can't be written as
+// an instruction that assembles the same way (illegal opcodes,
+// absolute addressing with a zero page operand, instructions cut by
+// a data range or the end of the file) is written as DFB bytes.
+
+const disasmBytesPerLine = 8
+
+// disasmItem is either an instruction or a single data byte
+type disasmItem struct {
+	addr    int
+	opc     *opcode
+	operand int
+	data    byte
+}
+
+func (di disasmItem) size() int {
+	if di.opc == nil {
+		return 1
+	}
+	return di.opc.len
+}
+
+// addrRange is an inclusive range of addresses
+type addrRange struct {
+	start int
+	end   int
+}
+
+type disassembler struct {
+	org    int
+	code   []byte
+	data   []addrRange
+	names  map[int]string // labels given by the user
+	items  []disasmItem
+	starts map[int]bool // addresses where an item starts
+	labels map[int]string
+}
+
+var decodeTable map[byte]opcode
+
+// opcodeByHex returns the opcode for
+// a byte, nil for illegal opcodes
+func opcodeByHex(b byte) *opcode {
+	if decodeTable == nil {
+		decodeTable = map[byte]opcode{}
+		for _, opc := range opcodes {
+			decodeTable[opc.hex] = opc
+		}
+	}
+	if opc, found := decodeTable[b]; found {
+		return &opc
+	}
+	return nil
+}
+
+func (d *disassembler) isData(addr int) bool {
+	for _, r := range d.data {
+		if addr >= r.start && addr <= r.end {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *disassembler) end() int {
+	return d.org + len(d.code)
+}
+
+// decode walks the code linearly splitting it in items
+func (d *disassembler) decode() {
+	d.items = []disasmItem{}
+	d.starts = map[int]bool{}
+
+	for pc := d.org; pc < d.end(); {
+		item := disasmItem{addr: pc, data: d.code[pc-d.org]}
+		if opc := opcodeByHex(item.data); opc != nil && !d.isData(pc) && d.fits(pc, opc.len) {
+			switch opc.len {
+			case 2:
+				item.operand = int(d.code[pc-d.org+1])
+			case 3:
+				item.operand = int(d.code[pc-d.org+1]) | int(d.code[pc-d.org+2])<<8
+			}
+			if reassembles(*opc, item.operand) {
+				item.opc = opc
+			}
+
+			// branches wrapping around the ends of memory have
+			// no target that assembles back, so they stay as data
+			if t := item.target(); opc.mode == RL && (t < 0 || t > 0xFFFF) {
+				item.opc = nil
+			}
+		}
+		d.items = append(d.items, item)
+		d.starts[pc] = true
+		pc += item.size()
+	}
+}
+
+// fits tells if an instruction is fully
+// in the code and not over a data range
+func (d *disassembler) fits(pc, length int) bool {
+	for a := pc; a < pc+length; a++ {
+		if a >= d.end() || d.isData(a) {
+			return false
+		}
+	}
+	return true
+}
+
+// reassembles tells if the instruction assembles back to the same
+// opcode: absolute operands in the zero page are assembled with the
+// zero page mode when the instruction has one
+func reassembles(opc opcode, operand int) bool {
+	if operand > 0xFF {
+		return true
+	}
+	var zpMode string
+	switch opc.mode {
+	case ABS:
+		zpMode = ZP
+	case ABSX:
+		zpMode = ZPX
+	case ABSY:
+		zpMode = ZPY
+	default:
+		return true
+	}
+	_, hasZP := opcodes[fmt.Sprintf("%s-%s", opc.mnemonic, zpMode)]
+	return !hasZP
+}
+
+// target returns the address an instruction refers to, -1 if none
+func (di disasmItem) target() int {
+	if di.opc == nil {
+		return -1
+	}
+	switch di.opc.mode {
+	case RL:
+		offset := di.operand
+		if offset > 0x7F {
+			offset -= 0x100
+		}
+		return di.addr + 2 + offset
+	case ABS, ABSX, ABSY, IND:
+		return di.operand
+	}
+	return -1
+}
+
+// makeLabels names the addresses used by the code that are the
+// start of an item: with the user's names when given or like
+// `Lc000` otherwise. Labels under $100 are left as numbers since
+// they can only be used in zero page modes once defined.
+func (d *disassembler) makeLabels() {
+	d.labels = map[int]string{}
+	for addr, name := range d.names {
+		if d.starts[addr] && addr > 0xFF {
+			d.labels[addr] = name
+		}
+	}
+	for _, item := range d.items {
+		t := item.target()
+		if _, named := d.labels[t]; named || !d.starts[t] || t <= 0xFF {
+			continue
+		}
+		d.labels[t] = fmt.Sprintf("L%04x", t)
+	}
+}
+
+// aliases are the user's names that can't be labels
+func (d *disassembler) aliases() []int {
+	addrs := []int{}
+	for addr, name := range d.names {
+		if d.labels[addr] != name {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Ints(addrs)
+	return addrs
+}
+
+func (d *disassembler) symbolFor(addr int) (string, bool) {
+	if name, found := d.labels[addr]; found {
+		return name, true
+	}
+	if name, found := d.names[addr]; found {
+		return name, true
+	}
+	return "", false
+}
+
+// operandText writes the operand of an instruction
+// using labels for the addresses where possible
+func (d *disassembler) operandText(item disasmItem) string {
+
+	value := fmt.Sprintf("$%02x", item.operand)
+	if item.opc.len == 3 {
+		value = fmt.Sprintf("$%04x", item.operand)
+	}
+	if item.opc.mode != IM {
+		if sym, found := d.symbolFor(item.operand); found {
+			value = sym
+		}
+	}
+
+	switch item.opc.mode {
+	case IMP:
+		return ""
+	case ACC:
+		return "a"
+	case IM:
+		return "#" + value
+	case RL:
+		t := item.target()
+		if sym, found := d.symbolFor(t); found {
+			return sym
+		}
+		return fmt.Sprintf("$%04x", t)
+	case ZPX, ABSX:
+		return value + ",x"
+	case ZPY, ABSY:
+		return value + ",y"
+	case IND:
+		return "(" + value + ")"
+	case IX:
+		return "(" + value + ",x)"
+	case IY:
+		return "(" + value + "),y"
+	}
+	return value
+}
+
+func (d *disassembler) write(source string) []byte {
+	buffer := new(bytes.Buffer)
+
+	fmt.Fprintf(buffer, ";; disassembled from %s\n\n", source)
+
+	if aliases := d.aliases(); len(aliases) > 0 {
+		for _, addr := range aliases {
+			if addr > 0xFF {
+				fmt.Fprintf(buffer, "%s = $%04x\n", d.names[addr], addr)
+			} else {
+				fmt.Fprintf(buffer, "%s = $%02x\n", d.names[addr], addr)
+			}
+		}
+		buffer.WriteString("\n")
+	}
+
+	fmt.Fprintf(buffer, "\t.org $%04x\n\n", d.org)
+
+	data := []string{}
+	flushData := func() {
+		if len(data) > 0 {
+			fmt.Fprintf(buffer, "\tdfb %s\n", strings.Join(data, ","))
+			data = data[:0]
+		}
+	}
+
+	for _, item := range d.items {
+		if label, found := d.labels[item.addr]; found {
+			flushData()
+			fmt.Fprintf(buffer, "%s:\n", label)
+		}
+
+		if item.opc == nil {
+			data = append(data, fmt.Sprintf("$%02x", item.data))
+			if len(data) == disasmBytesPerLine {
+				flushData()
+			}
+			continue
+		}
+		flushData()
+
+		if opr := d.operandText(item); opr != "" {
+			fmt.Fprintf(buffer, "\t%s %s\n", strings.ToLower(item.opc.mnemonic), opr)
+		} else {
+			fmt.Fprintf(buffer, "\t%s\n", strings.ToLower(item.opc.mnemonic))
+		}
+	}
+	flushData()
+
+	return buffer.Bytes()
+}
+
+func disassemble(org int, code []byte, data []addrRange, names map[int]string, source string) []byte {
+	d := &disassembler{org: org, code: code, data: data, names: names}
+	d.decode()
+	d.makeLabels()
+	return d.write(source)
+}
+
+// -----------------------------------------------------------------------------
+// Hints:
+// -----------------------------------------------------------------------------
+
+// readDataRanges reads a list of ranges like `$c100-$c1ff,$c300`
+func readDataRanges(s string) ([]addrRange, error) {
+	ranges := []addrRange{}
+	for _, r := range strings.Split(s, ",") {
+		if r = strings.TrimSpace(r); r == "" {
+			continue
+		}
+		bounds := strings.SplitN(r, "-", 2)
+		start, startErr := readNumber(bounds[0])
+		if startErr != nil {
+			return nil, startErr
+		}
+		end := start
+		if len(bounds) == 2 {
+			var endErr error
+			if end, endErr = readNumber(bounds[1]); endErr != nil {
+				return nil, endErr
+			}
+		}
+		if end < start {
+			return nil, fmt.Errorf("Invalid data range %s", r)
+		}
+		ranges = append(ranges, addrRange{start, end})
+	}
+	return ranges, nil
+}
+
+var viceLabel = regexp.MustCompile(`^al\s+(?:C:)?([0-9a-fA-F]+)\s+\.(\S+)$`)
+
+// readLabelFile reads names for addresses, either as xbbasm
+// aliases (`border = $d020`) or as VICE labels (`al C:d020 .border`)
+func readLabelFile(filename string) (map[int]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	names := map[int]string{}
+	defined := map[string]bool{}
+	fsc := bufio.NewScanner(f)
+	lnum := 0
+	for fsc.Scan() {
+		lnum++
+		l := strings.TrimSpace(strings.Split(fsc.Text(), ";")[0])
+		if l == "" {
+			continue
+		}
+
+		var name, value string
+		if m := viceLabel.FindStringSubmatch(l); m != nil {
+			name, value = m[2], "$"+m[1]
+		} else if fields := strings.SplitN(l, "=", 2); len(fields) == 2 {
+			name, value = strings.TrimSpace(fields[0]), strings.TrimSpace(fields[1])
+		} else {
+			return nil, fmt.Errorf("%s:%d:Syntax error in label definition", filename, lnum)
+		}
+
+		addr, addrErr := readNumber(value)
+		if addrErr != nil || addr > 0xFFFF {
+			return nil, fmt.Errorf("%s:%d:Invalid address %s", filename, lnum, value)
+		}
+		if !isValidLabel(name) {
+			return nil, fmt.Errorf("%s:%d:Invalid label name %s", filename, lnum, name)
+		} else if defined[name] {
+			return nil, fmt.Errorf("%s:%d:Label %s defined twice", filename, lnum, name)
+		}
+		defined[name] = true
+		names[addr] = name
+	}
+	return names, fsc.Err()
+}
+
+var labelName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// isValidLabel tells if the name can be used
+// in an operand and is read back as a label
+func isValidLabel(name string) bool {
+	if !labelName.MatchString(name) || isOpcode(name) || readPseudoOpcode(name) != nil {
+		return false
+	}
+	switch strings.ToUpper(name) {
+	case "A", "X", "Y":
+		return false
+	}
+	_, label, err := readAddress(name)
+	return err == nil && label == name
+}
+
+// readNumber reads a number in any of the formats of the sources
+func readNumber(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("Missing number")
+	}
+	v, label, err := readAddress(s)
+	if err != nil {
+		return 0, err
+	} else if label != "" {
+		return 0, fmt.Errorf("Invalid number %s", s)
+	}
+	return v, nil
+}
+
+// -----------------------------------------------------------------------------
+// Command:
+// -----------------------------------------------------------------------------
+
+// disasmMain runs `xbbasm disasm [options] file.prg`
+func disasmMain(args []string) {
+
+	fs := flag.NewFlagSet("disasm", flag.ExitOnError)
+	org := fs.String("org", "", "load address for a raw binary (without it the input is a PRG)")
+	output := fs.String("out", "", "output filename (default: standard output)")
+	labels := fs.String("labels", "", "file with names for addresses (`name = $addr` or VICE `al` lines)")
+	var data stringList
+	fs.Var(&data, "data", "range of data bytes as `start-end` (like $c100-$c1ff), can be repeated")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fail("must specify input file")
+	}
+	input := fs.Arg(0)
+
+	code, err := ioutil.ReadFile(input)
+	if err != nil {
+		fail(err.Error())
+	}
+
+	var start int
+	if *org != "" {
+		if start, err = readNumber(*org); err != nil {
+			fail(err.Error())
+		}
+	} else if len(code) < 2 {
+		fail(fmt.Sprintf("%s is not a PRG file", input))
+	} else {
+		start = int(code[0]) | int(code[1])<<8
+		code = code[2:]
+	}
+	if start+len(code) > 0x10000 {
+		fail(fmt.Sprintf("%s does not fit in memory at $%04x", input, start))
+	}
+
+	ranges := []addrRange{}
+	for _, d := range data {
+		r, rErr := readDataRanges(d)
+		if rErr != nil {
+			fail(rErr.Error())
+		}
+		ranges = append(ranges, r...)
+	}
+
+	names := map[int]string{}
+	if *labels != "" {
+		if names, err = readLabelFile(*labels); err != nil {
+			fail(err.Error())
+		}
+	}
+
+	source := disassemble(start, code, ranges, names, filepath.Base(input))
+	if *output == "" {
+		os.Stdout.Write(source)
+	} else if err := ioutil.WriteFile(*output, source, 0644); err != nil {
+		fail(err.Error())
+	}
+}
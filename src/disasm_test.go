@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// reassemble assembles the disassembled sources
+// and returns the program without the load address
+func reassemble(t *testing.T, source []byte) []byte {
+	defer resetSymbols()
+
+	asm, err := assembleLines(t, []string{string(source)})
+	if err != nil {
+		t.Fatalf("%s\n%s", err.Error(), source)
+	}
+	return asm.program[2:]
+}
+
+func TestDisassembleRoundTrip(t *testing.T) {
+	binaries, _ := filepath.Glob("../test_binaries/*.prg")
+	for _, b := range binaries {
+		prg, err := ioutil.ReadFile(b)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		org := int(prg[0]) | int(prg[1])<<8
+		source := disassemble(org, prg[2:], nil, nil, b)
+		if !bytes.Equal(reassemble(t, source), prg[2:]) {
+			t.Errorf("%s: reassembled program differs", b)
+		}
+	}
+}
+
+func TestDisassembleHints(t *testing.T) {
+	code := []byte{
+		0xAD, 0x10, 0x00, // lda $0010 (as data, the rest is a bpl)
+		0xB9, 0x10, 0x00, // lda $0010,y
+		0x6C, 0x10, 0xC0, // jmp ($c010)
+		0xD0, 0xFE, // bne to itself
+		0x02,             // illegal opcode
+		0x8D, 0x20, 0xD0, // sta $d020
+		0xA9,                   // lda # cut by the data range
+		0x10, 0xC0, 0x4C, 0x0E, // data
+		0xB1, 0xFB, // lda ($fb),y
+		0x20, 0x0A, 0xC0, // jsr into the middle of an instruction
+	}
+	names := map[int]string{0xD020: "border", 0xFB: "ptr", 0xC00B: "halt", 0xC00A: "mid"}
+	data := []addrRange{{0xC010, 0xC013}}
+
+	source := disassemble(0xC000, code, data, names, "test")
+
+	for _, expected := range []string{
+		"border = $d020\n", "ptr = $fb\n", "mid = $c00a\n",
+		"\tdfb $ad\n\tbpl Lc003\n", "\tlda $0010,y\n", "\tjmp (Lc010)\n",
+		"Lc009:\n\tbne Lc009\n", "halt:\n\tdfb $02\n", "\tsta border\n",
+		"Lc010:\n\tdfb $10,$c0,$4c,$0e\n", "\tlda (ptr),y\n", "\tjsr mid\n",
+	} {
+		if !strings.Contains(string(source), expected) {
+			t.Errorf("expected %q in:\n%s", expected, source)
+		}
+	}
+
+	if !bytes.Equal(reassemble(t, source), code) {
+		t.Errorf("reassembled program differs")
+	}
+}
+
+func TestDisassembleWrappedBranches(t *testing.T) {
+	var tests = []struct {
+		org  int
+		code []byte
+	}{
+		{0x0000, []byte{0xEA, 0xD0, 0xF0}},       // bne to $fff3
+		{0xFFFC, []byte{0xEA, 0xD0, 0x10, 0x60}}, // bne to $10010
+		{0x0002, []byte{0xD0, 0xFC, 0x60}},       // bne to $0000
+	}
+	for i, test := range tests {
+		source := disassemble(test.org, test.code, nil, nil, "wrap.prg")
+		if wraps := i < 2; wraps == strings.Contains(string(source), "bne") {
+			t.Errorf("test %d: unexpected branch in:\n%s", i, source)
+		}
+		if !bytes.Equal(reassemble(t, source), test.code) {
+			t.Errorf("test %d: reassembled program differs:\n%s", i, source)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+// defaultFont is a font drawn for xbbasm in the style of the upper case
+// and graphics character set, with the screen codes $00-$7F in the same
+// places as in the character ROM: letters, digits and punctuation, then
+// the lines, corners, card suits and blocks. Each character is 8 rows
+// with the leftmost pixel in the highest bit.
+var defaultFont = [128][8]byte{
+	{0x3C, 0x66, 0x6E, 0x6E, 0x60, 0x62, 0x3C, 0x00}, // @
+	{0x18, 0x3C, 0x66, 0x7E, 0x66, 0x66, 0x66, 0x00}, // A
+	{0x7C, 0x66, 0x66, 0x7C, 0x66, 0x66, 0x7C, 0x00}, // B
+	{0x3C, 0x66, 0x60, 0x60, 0x60, 0x66, 0x3C, 0x00}, // C
+	{0x78, 0x6C, 0x66, 0x66, 0x66, 0x6C, 0x78, 0x00}, // D
+	{0x7E, 0x60, 0x60, 0x78, 0x60, 0x60, 0x7E, 0x00}, // E
+	{0x7E, 0x60, 0x60, 0x78, 0x60, 0x60, 0x60, 0x00}, // F
+	{0x3C, 0x66, 0x60, 0x6E, 0x66, 0x66, 0x3C, 0x00}, // G
+	{0x66, 0x66, 0x66, 0x7E, 0x66, 0x66, 0x66, 0x00}, // H
+	{0x3C, 0x18, 0x18, 0x18, 0x18, 0x18, 0x3C, 0x00}, // I
+	{0x1E, 0x0C, 0x0C, 0x0C, 0x0C, 0x6C, 0x38, 0x00}, // J
+	{0x66, 0x6C, 0x78, 0x70, 0x78, 0x6C, 0x66, 0x00}, // K
+	{0x60, 0x60, 0x60, 0x60, 0x60, 0x60, 0x7E, 0x00}, // L
+	{0x63, 0x77, 0x7F, 0x6B, 0x63, 0x63, 0x63, 0x00}, // M
+	{0x66, 0x76, 0x7E, 0x7E, 0x6E, 0x66, 0x66, 0x00}, // N
+	{0x3C, 0x66, 0x66, 0x66, 0x66, 0x66, 0x3C, 0x00}, // O
+	{0x7C, 0x66, 0x66, 0x7C, 0x60, 0x60, 0x60, 0x00}, // P
+	{0x3C, 0x66, 0x66, 0x66, 0x66, 0x3C, 0x0E, 0x00}, // Q
+	{0x7C, 0x66, 0x66, 0x7C, 0x78, 0x6C, 0x66, 0x00}, // R
+	{0x3C, 0x66, 0x60, 0x3C, 0x06, 0x66, 0x3C, 0x00}, // S
+	{0x7E, 0x18, 0x18, 0x18, 0x18, 0x18, 0x18, 0x00}, // T
+	{0x66, 0x66, 0x66, 0x66, 0x66, 0x66, 0x3C, 0x00}, // U
+	{0x66, 0x66, 0x66, 0x66, 0x66, 0x3C, 0x18, 0x00}, // V
+	{0x63, 0x63, 0x63, 0x6B, 0x7F, 0x77, 0x63, 0x00}, // W
+	{0x66, 0x66, 0x3C, 0x18, 0x3C, 0x66, 0x66, 0x00}, // X
+	{0x66, 0x66, 0x66, 0x3C, 0x18, 0x18, 0x18, 0x00}, // Y
+	{0x7E, 0x06, 0x0C, 0x18, 0x30, 0x60, 0x7E, 0x00}, // Z
+	{0x3C, 0x30, 0x30, 0x30, 0x30, 0x30, 0x3C, 0x00}, // [
+	{0x0C, 0x12, 0x30, 0x7C, 0x30, 0x62, 0xFC, 0x00}, // pound
+	{0x3C, 0x0C, 0x0C, 0x0C, 0x0C, 0x0C, 0x3C, 0x00}, // ]
+	{0x00, 0x18, 0x3C, 0x7E, 0x18, 0x18, 0x18, 0x18}, // up arrow
+	{0x00, 0x10, 0x30, 0x7F, 0x7F, 0x30, 0x10, 0x00}, // left arrow
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, // space
+	{0x18, 0x18, 0x18, 0x18, 0x00, 0x00, 0x18, 0x00}, // !
+	{0x66, 0x66, 0x66, 0x00, 0x00, 0x00, 0x00, 0x00}, // "
+	{0x66, 0x66, 0xFF, 0x66, 0xFF, 0x66, 0x66, 0x00}, // #
+	{0x18, 0x3E, 0x60, 0x3C, 0x06, 0x7C, 0x18, 0x00}, // $
+	{0x62, 0x66, 0x0C, 0x18, 0x30, 0x66, 0x46, 0x00}, // %
+	{0x3C, 0x66, 0x3C, 0x38, 0x67, 0x66, 0x3F, 0x00}, // &
+	{0x06, 0x0C, 0x18, 0x00, 0x00, 0x00, 0x00, 0x00}, // '
+	{0x0C, 0x18, 0x30, 0x30, 0x30, 0x18, 0x0C, 0x00}, // (
+	{0x30, 0x18, 0x0C, 0x0C, 0x0C, 0x18, 0x30, 0x00}, // )
+	{0x00, 0x66, 0x3C, 0xFF, 0x3C, 0x66, 0x00, 0x00}, // *
+	{0x00, 0x18, 0x18, 0x7E, 0x18, 0x18, 0x00, 0x00}, // +
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x18, 0x18, 0x30}, // ,
+	{0x00, 0x00, 0x00, 0x7E, 0x00, 0x00, 0x00, 0x00}, // -
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x18, 0x18, 0x00}, // .
+	{0x00, 0x03, 0x06, 0x0C, 0x18, 0x30, 0x60, 0x00}, // /
+	{0x3C, 0x66, 0x6E, 0x76, 0x66, 0x66, 0x3C, 0x00}, // 0
+	{0x18, 0x18, 0x38, 0x18, 0x18, 0x18, 0x7E, 0x00}, // 1
+	{0x3C, 0x66, 0x06, 0x0C, 0x30, 0x60, 0x7E, 0x00}, // 2
+	{0x3C, 0x66, 0x06, 0x1C, 0x06, 0x66, 0x3C, 0x00}, // 3
+	{0x06, 0x0E, 0x1E, 0x66, 0x7F, 0x06, 0x06, 0x00}, // 4
+	{0x7E, 0x60, 0x7C, 0x06, 0x06, 0x66, 0x3C, 0x00}, // 5
+	{0x3C, 0x66, 0x60, 0x7C, 0x66, 0x66, 0x3C, 0x00}, // 6
+	{0x7E, 0x66, 0x0C, 0x18, 0x18, 0x18, 0x18, 0x00}, // 7
+	{0x3C, 0x66, 0x66, 0x3C, 0x66, 0x66, 0x3C, 0x00}, // 8
+	{0x3C, 0x66, 0x66, 0x3E, 0x06, 0x66, 0x3C, 0x00}, // 9
+	{0x00, 0x00, 0x18, 0x00, 0x00, 0x18, 0x00, 0x00}, // :
+	{0x00, 0x00, 0x18, 0x00, 0x00, 0x18, 0x18, 0x30}, // ;
+	{0x0E, 0x18, 0x30, 0x60, 0x30, 0x18, 0x0E, 0x00}, // <
+	{0x00, 0x00, 0x7E, 0x00, 0x7E, 0x00, 0x00, 0x00}, // =
+	{0x70, 0x18, 0x0C, 0x06, 0x0C, 0x18, 0x70, 0x00}, // >
+	{0x3C, 0x66, 0x06, 0x0C, 0x18, 0x00, 0x18, 0x00}, // ?
+	{0x00, 0x00, 0x00, 0xFF, 0xFF, 0x00, 0x00, 0x00}, // horizontal line
+	{0x08, 0x1C, 0x3E, 0x7F, 0x7F, 0x1C, 0x3E, 0x00}, // spade
+	{0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x10}, // vertical line, middle left
+	{0x00, 0x00, 0x00, 0xFF, 0x00, 0x00, 0x00, 0x00}, // horizontal line, row 3
+	{0x00, 0x00, 0xFF, 0x00, 0x00, 0x00, 0x00, 0x00}, // horizontal line, row 2
+	{0x00, 0xFF, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, // horizontal line, row 1
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0xFF, 0x00, 0x00}, // horizontal line, row 5
+	{0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20}, // vertical line, column 2
+	{0x04, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04}, // vertical line, column 5
+	{0x00, 0x00, 0x00, 0xE0, 0xF0, 0x38, 0x18, 0x18}, // rounded corner, left and down
+	{0x18, 0x18, 0x1C, 0x0F, 0x07, 0x00, 0x00, 0x00}, // rounded corner, up and right
+	{0x18, 0x18, 0x38, 0xF0, 0xE0, 0x00, 0x00, 0x00}, // rounded corner, up and left
+	{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0xFF}, // left and bottom edges
+	{0xC0, 0xE0, 0x70, 0x38, 0x1C, 0x0E, 0x07, 0x03}, // diagonal down
+	{0x03, 0x07, 0x0E, 0x1C, 0x38, 0x70, 0xE0, 0xC0}, // diagonal up
+	{0xFF, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80}, // left and top edges
+	{0xFF, 0x01, 0x01, 0x01, 0x01, 0x01, 0x01, 0x01}, // right and top edges
+	{0x00, 0x3C, 0x7E, 0x7E, 0x7E, 0x7E, 0x3C, 0x00}, // filled circle
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xFF, 0x00}, // horizontal line, row 6
+	{0x36, 0x7F, 0x7F, 0x7F, 0x3E, 0x1C, 0x08, 0x00}, // heart
+	{0x40, 0x40, 0x40, 0x40, 0x40, 0x40, 0x40, 0x40}, // vertical line, column 1
+	{0x00, 0x00, 0x00, 0x07, 0x0F, 0x1C, 0x18, 0x18}, // rounded corner, right and down
+	{0xC3, 0xE7, 0x7E, 0x3C, 0x3C, 0x7E, 0xE7, 0xC3}, // diagonal cross
+	{0x00, 0x3C, 0x66, 0x42, 0x42, 0x66, 0x3C, 0x00}, // circle
+	{0x18, 0x18, 0x66, 0x66, 0x18, 0x18, 0x3C, 0x00}, // club
+	{0x02, 0x02, 0x02, 0x02, 0x02, 0x02, 0x02, 0x02}, // vertical line, column 6
+	{0x08, 0x1C, 0x3E, 0x7F, 0x3E, 0x1C, 0x08, 0x00}, // diamond
+	{0x18, 0x18, 0x18, 0xFF, 0xFF, 0x18, 0x18, 0x18}, // cross
+	{0xC0, 0xC0, 0x30, 0x30, 0xC0, 0xC0, 0x30, 0x30}, // checkerboard, left half
+	{0x18, 0x18, 0x18, 0x18, 0x18, 0x18, 0x18, 0x18}, // vertical line
+	{0x00, 0x00, 0x03, 0x3E, 0x76, 0x36, 0x36, 0x00}, // pi
+	{0xFF, 0x7F, 0x3F, 0x1F, 0x0F, 0x07, 0x03, 0x01}, // triangle, upper right
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, // shifted space
+	{0xF0, 0xF0, 0xF0, 0xF0, 0xF0, 0xF0, 0xF0, 0xF0}, // left half
+	{0x00, 0x00, 0x00, 0x00, 0xFF, 0xFF, 0xFF, 0xFF}, // bottom half
+	{0xFF, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, // top line
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xFF}, // bottom line
+	{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80}, // left line
+	{0xCC, 0xCC, 0x33, 0x33, 0xCC, 0xCC, 0x33, 0x33}, // checkerboard
+	{0x01, 0x01, 0x01, 0x01, 0x01, 0x01, 0x01, 0x01}, // right line
+	{0x00, 0x00, 0x00, 0x00, 0xCC, 0xCC, 0x33, 0x33}, // checkerboard, bottom half
+	{0xFF, 0xFE, 0xFC, 0xF8, 0xF0, 0xE0, 0xC0, 0x80}, // triangle, upper left
+	{0x03, 0x03, 0x03, 0x03, 0x03, 0x03, 0x03, 0x03}, // right quarter
+	{0x18, 0x18, 0x18, 0x1F, 0x1F, 0x18, 0x18, 0x18}, // tee, right
+	{0x00, 0x00, 0x00, 0x00, 0x0F, 0x0F, 0x0F, 0x0F}, // quadrant, lower right
+	{0x18, 0x18, 0x18, 0x1F, 0x1F, 0x00, 0x00, 0x00}, // corner, up and right
+	{0x00, 0x00, 0x00, 0xF8, 0xF8, 0x18, 0x18, 0x18}, // corner, left and down
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xFF, 0xFF}, // bottom quarter
+	{0x00, 0x00, 0x00, 0x1F, 0x1F, 0x18, 0x18, 0x18}, // corner, right and down
+	{0x18, 0x18, 0x18, 0xFF, 0xFF, 0x00, 0x00, 0x00}, // tee, up
+	{0x00, 0x00, 0x00, 0xFF, 0xFF, 0x18, 0x18, 0x18}, // tee, down
+	{0x18, 0x18, 0x18, 0xF8, 0xF8, 0x18, 0x18, 0x18}, // tee, left
+	{0xC0, 0xC0, 0xC0, 0xC0, 0xC0, 0xC0, 0xC0, 0xC0}, // left quarter
+	{0xE0, 0xE0, 0xE0, 0xE0, 0xE0, 0xE0, 0xE0, 0xE0}, // left three eighths
+	{0x07, 0x07, 0x07, 0x07, 0x07, 0x07, 0x07, 0x07}, // right three eighths
+	{0xFF, 0xFF, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, // top quarter
+	{0xFF, 0xFF, 0xFF, 0x00, 0x00, 0x00, 0x00, 0x00}, // top three eighths
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0xFF, 0xFF, 0xFF}, // bottom three eighths
+	{0x01, 0x01, 0x01, 0x01, 0x01, 0x01, 0x01, 0xFF}, // right and bottom edges
+	{0x00, 0x00, 0x00, 0x00, 0xF0, 0xF0, 0xF0, 0xF0}, // quadrant, lower left
+	{0x0F, 0x0F, 0x0F, 0x0F, 0x00, 0x00, 0x00, 0x00}, // quadrant, upper right
+	{0x18, 0x18, 0x18, 0xF8, 0xF8, 0x00, 0x00, 0x00}, // corner, up and left
+	{0xF0, 0xF0, 0xF0, 0xF0, 0x00, 0x00, 0x00, 0x00}, // quadrant, upper left
+	{0xF0, 0xF0, 0xF0, 0xF0, 0x0F, 0x0F, 0x0F, 0x0F}, // quadrants, upper left and lower right
+}
+
+// defaultCharset lays the font out as the 2K of a character set,
+// with the reversed characters in the upper half
+func defaultCharset() []byte {
+	charset := make([]byte, 0x800)
+	for code := 0; code < 0x80; code++ {
+		for row, bits := range defaultFont[code] {
+			charset[code*8+row] = bits
+			charset[(code+0x80)*8+row] = ^bits
+		}
+	}
+	return charset
+}
@@ -24,6 +24,8 @@ func resolveFormula(f string) (result int, err error) {
 		result = int(rInt)
 	} else if rFloat, ok := r.(float64); ok && rFloat >= 0 {
 		result = int(rFloat)
+	} else if rBool, ok := r.(bool); ok {
+		result = int(frmBool(rBool))
 	} else {
 		err = fmt.Errorf("error: formula %s evaluates to unexpected result %v", f, r)
 	}
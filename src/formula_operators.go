@@ -62,9 +62,20 @@ func frmOperCheckArgs(operation string, arguments []interface{}, n int) error {
 	return nil
 }
 
+// boolean results of comparisons
+// are taken as 1 or 0 by the other operations
+func frmBool(b bool) uint {
+	if b {
+		return 1
+	}
+	return 0
+}
+
 func frmUInt(n interface{}) (uint, error) {
 	if uintVal, ok := n.(uint); ok {
 		return uintVal, nil
+	} else if boolVal, ok := n.(bool); ok {
+		return frmBool(boolVal), nil
 	} else if intVal, ok := n.(int); ok && intVal >= 0 {
 		return uint(intVal), nil
 	} else if symbol, ok := n.(string); ok {
@@ -81,6 +92,10 @@ func frmUInt(n interface{}) (uint, error) {
 func frmInt(n interface{}) (int, error) {
 	if intVal, ok := n.(int); ok {
 		return intVal, nil
+	} else if uintVal, ok := n.(uint); ok {
+		return int(uintVal), nil
+	} else if boolVal, ok := n.(bool); ok {
+		return int(frmBool(boolVal)), nil
 	} else if symbol, ok := n.(string); ok {
 		return lookupSymbol(symbol)
 	}
@@ -92,6 +107,10 @@ func frmFloat(f interface{}) (float64, error) {
 		return flVal, nil
 	} else if intVal, ok := f.(int); ok {
 		return float64(intVal), nil
+	} else if uintVal, ok := f.(uint); ok {
+		return float64(uintVal), nil
+	} else if boolVal, ok := f.(bool); ok {
+		return float64(frmBool(boolVal)), nil
 	} else if symbol, ok := f.(string); ok {
 		intVal, err := lookupSymbol(symbol)
 		if err != nil {
@@ -30,6 +30,12 @@ func TestResolveFormula(t *testing.T) {
 		`[<b 65535]`, 255,
 	}, {
 		`[AND 255 170]`, 170, // AND 1111 1111 WITH 1010 1010 = 1010 1010
+	}, {
+		`[= [>b $c0ff] $c0]`, 1,
+	}, {
+		`[< [<b $c0ff] 16]`, 0,
+	}, {
+		`[AND [> 3 2] [!= 1 2]]`, 1,
 	}}
 
 	var r int
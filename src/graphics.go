@@ -0,0 +1,474 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/png"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Graphics from PNG images, converted when assembling. Pixels take the
+// closest color of the C64 palette and are packed into bytes with the
+// values of their colors, given as a list or taken from the image.
+//
+// Character sets and bitmaps:
+//
+//	font	./charset font.png
+//	level	./charset level.png multicolor dedup
+//	title	./hires title.png
+//	pic	./koala pic.png background=0
+//
+// `./charset` reads 8x8 pixel characters, left to right and top to
+// bottom, into a 2K character set, hires or with `multicolor` and
+// `colors=` as for sprites. The screen map after the set gives the
+// character for each cell of the image, with `dedup` repeated
+// characters are only kept once and share their index in it.
+//
+// `./hires` reads a 320x200 image with up to 2 colors in each 8x8
+// cell, writing the 8000 bytes bitmap and then the 1000 bytes of the
+// screen RAM with the colors, the one with the higher palette index
+// for the set bits.
+//
+// `./koala` reads a 160x200 image (or a 320x200 one drawn with double
+// wide pixels) with up to 3 colors in each cell besides the background,
+// the most used color unless given, and lays it out as Koala Painter
+// files do: bitmap, screen RAM, color RAM and the background color.
+//
+// The pieces are named after the label of the line or else the file,
+// `{name}.chars`, `{name}.map`, `{name}.bitmap`, `{name}.screen`,
+// `{name}.colorram` and `{name}.background` are their addresses, and
+// `{name}.count`, `{name}.cols` and `{name}.rows` the number of
+// characters and the size of the map.
+
+const (
+	cellSize     = 8
+	bitmapWidth  = screenCols * cellSize
+	bitmapHeight = screenRows * cellSize
+	bitmapBytes  = bitmapWidth * bitmapHeight / 8
+	screenBytes  = screenCols * screenRows
+	koalaWidth   = bitmapWidth / 2
+	maxChars     = 256
+	bitmapAlign  = 0x2000
+)
+
+// graphicsPiece is a part of the converted data
+// that gets its own symbol with its address
+type graphicsPiece struct {
+	name  string
+	data  []byte
+	align int // for the VIC-II to see it, 0 when it can go anywhere
+}
+
+// graphicsValue is a number about the converted data
+type graphicsValue struct {
+	name  string
+	value int
+}
+
+type graphics struct {
+	pieces []graphicsPiece
+	values []graphicsValue
+}
+
+// isGraphics tells if the directive converts an image
+func isGraphics(mnemonic string) bool {
+	switch mnemonic {
+	case "./CHARSET", "./HIRES", "./KOALA":
+		return true
+	}
+	return false
+}
+
+// graphicsName is the name for the symbols of the
+// line, its label or else the name of the file
+func graphicsName(p *tokenizedLine) string {
+	if p.label != "" {
+		return strings.TrimSuffix(p.label, ":")
+	}
+	return p.opr.args[0]
+}
+
+// convertGraphics reads the image of the operand
+// and converts it as the directive says
+func convertGraphics(mnemonic string, opr operand) (*graphics, error) {
+	img, err := readPNG(opr.label)
+	if err != nil {
+		return nil, err
+	}
+
+	switch mnemonic {
+	case "./CHARSET":
+		return convertCharset(img, opr.args[1] == "multicolor", colorList(opr.args[2]), opr.args[3] == "dedup")
+	case "./HIRES":
+		return convertHires(img)
+	default:
+		background := -1
+		if opr.args[1] != "" {
+			background, _ = strconv.Atoi(opr.args[1])
+		}
+		return convertKoala(img, background)
+	}
+}
+
+func convertCharset(img image.Image, multicolor bool, colors []int, dedup bool) (*graphics, error) {
+	bounds := img.Bounds()
+	if bounds.Dx()%cellSize != 0 || bounds.Dy()%cellSize != 0 {
+		return nil, fmt.Errorf("Image of %dx%d pixels is not made of 8x8 characters", bounds.Dx(), bounds.Dy())
+	}
+
+	values, err := colorValues(img, multicolor, colors)
+	if err != nil {
+		return nil, err
+	}
+
+	chars := []byte{}
+	screenMap := []byte{}
+	found := map[string]int{}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += cellSize {
+		for x := bounds.Min.X; x < bounds.Max.X; x += cellSize {
+			char, charErr := readRows(img, x, y, cellSize, cellSize, bitsPerPixel(multicolor), values)
+			if charErr != nil {
+				return nil, charErr
+			}
+			index, seen := found[string(char)]
+			if !seen || !dedup {
+				if index = len(chars) / cellSize; index >= maxChars {
+					return nil, fmt.Errorf("More than %d characters in the image", maxChars)
+				}
+				found[string(char)] = index
+				chars = append(chars, char...)
+			}
+			screenMap = append(screenMap, byte(index))
+		}
+	}
+
+	g := &graphics{
+		pieces: []graphicsPiece{
+			{"chars", append(chars, make([]byte, charsetSize-len(chars))...), charsetSize},
+			{"map", screenMap, 0},
+		},
+		values: []graphicsValue{
+			{"count", len(chars) / cellSize},
+			{"cols", bounds.Dx() / cellSize},
+			{"rows", bounds.Dy() / cellSize},
+		},
+	}
+	return g, nil
+}
+
+func convertHires(img image.Image) (*graphics, error) {
+	bounds := img.Bounds()
+	if bounds.Dx() != bitmapWidth || bounds.Dy() != bitmapHeight {
+		return nil, fmt.Errorf("Image of %dx%d pixels is not a 320x200 bitmap", bounds.Dx(), bounds.Dy())
+	}
+
+	bitmap := make([]byte, 0, bitmapBytes)
+	screen := make([]byte, 0, screenBytes)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += cellSize {
+		for x := bounds.Min.X; x < bounds.Max.X; x += cellSize {
+			used := cellColors(img, image.Rect(x, y, x+cellSize, y+cellSize), 1, -1)
+			if len(used) > 2 {
+				return nil, fmt.Errorf("Cell at %d,%d has %d colors, hires bitmaps can only have 2", x, y, len(used))
+			}
+
+			// the background for cells of a single color
+			values := map[int]int{used[0]: 0}
+			cellColor := used[0]
+			if len(used) == 2 {
+				values[used[1]] = 1
+				cellColor |= used[1] << 4
+			}
+			cell, cellErr := readRows(img, x, y, cellSize, cellSize, 1, withTransparent(values))
+			if cellErr != nil {
+				return nil, cellErr
+			}
+			bitmap = append(bitmap, cell...)
+			screen = append(screen, byte(cellColor))
+		}
+	}
+
+	return &graphics{pieces: []graphicsPiece{
+		{"bitmap", bitmap, bitmapAlign},
+		{"screen", screen, 0},
+	}}, nil
+}
+
+func convertKoala(img image.Image, background int) (*graphics, error) {
+	bounds := img.Bounds()
+	if bounds.Dx() == koalaWidth && bounds.Dy() == bitmapHeight {
+		img = doubleWide{img}
+		bounds = img.Bounds()
+	} else if bounds.Dx() != bitmapWidth || bounds.Dy() != bitmapHeight {
+		return nil, fmt.Errorf("Image of %dx%d pixels is not a 160x200 or 320x200 bitmap", bounds.Dx(), bounds.Dy())
+	}
+
+	if background < 0 {
+		background = mostUsedColor(img)
+	}
+
+	bitmap := make([]byte, 0, bitmapBytes)
+	screen := make([]byte, 0, screenBytes)
+	colorRAM := make([]byte, 0, screenBytes)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += cellSize {
+		for x := bounds.Min.X; x < bounds.Max.X; x += cellSize {
+			used := cellColors(img, image.Rect(x, y, x+cellSize, y+cellSize), 2, background)
+			if len(used) > 3 {
+				return nil, fmt.Errorf("Cell at %d,%d has %d colors besides the background, multicolor bitmaps can only have 3", x, y, len(used))
+			}
+
+			// bit pairs 01 and 10 take their colors from the
+			// screen RAM and 11 from the color RAM
+			values := map[int]int{background: 0}
+			pairColors := [4]int{}
+			for i, c := range used {
+				values[c] = i + 1
+				pairColors[i+1] = c
+			}
+			cell, cellErr := readRows(img, x, y, cellSize, cellSize, 2, withTransparent(values))
+			if cellErr != nil {
+				return nil, cellErr
+			}
+			bitmap = append(bitmap, cell...)
+			screen = append(screen, byte(pairColors[1]<<4|pairColors[2]))
+			colorRAM = append(colorRAM, byte(pairColors[3]))
+		}
+	}
+
+	return &graphics{pieces: []graphicsPiece{
+		{"bitmap", bitmap, bitmapAlign},
+		{"screen", screen, 0},
+		{"colorram", colorRAM, 0},
+		{"background", []byte{byte(background)}, 0},
+	}}, nil
+}
+
+// doubleWide stretches an image to twice its width, for
+// multicolor images drawn with a pixel for each bit pair
+type doubleWide struct {
+	image.Image
+}
+
+func (d doubleWide) Bounds() image.Rectangle {
+	b := d.Image.Bounds()
+	return image.Rect(b.Min.X*2, b.Min.Y, b.Max.X*2, b.Max.Y)
+}
+
+func (d doubleWide) At(x, y int) color.Color {
+	return d.Image.At(x/2, y)
+}
+
+func readPNG(filename string) (image.Image, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+func bitsPerPixel(multicolor bool) int {
+	if multicolor {
+		return 2
+	}
+	return 1
+}
+
+// readRows packs the pixels of an area into bytes, row by row, with the
+// values of their colors. Multicolor pixels are read from the left one
+// of each pair.
+func readRows(img image.Image, left, top, width, height, bits int, values map[int]int) ([]byte, error) {
+	data := []byte{}
+	for y := top; y < top+height; y++ {
+		var b byte
+		for x := left; x < left+width; x += bits {
+			v, found := values[paletteIndex(img.At(x, y))]
+			if !found {
+				return nil, fmt.Errorf("Color %d at %d,%d is not in the colors given", paletteIndex(img.At(x, y)), x, y)
+			}
+			b = b<<uint(bits) | byte(v)
+			if (x-left+bits)%8 == 0 {
+				data = append(data, b)
+				b = 0
+			}
+		}
+	}
+	return data, nil
+}
+
+// colorValues maps the palette indexes to the values of the bits,
+// with -1 standing for transparent pixels. Without colors given they
+// are taken in order from the pixels read, the left one of each
+// multicolor pair.
+func colorValues(img image.Image, multicolor bool, colors []int) (map[int]int, error) {
+	values := map[int]int{-1: 0}
+
+	if len(colors) > 0 {
+		if multicolor && len(colors) != 4 {
+			return nil, fmt.Errorf("Multicolor graphics need 4 colors")
+		} else if !multicolor && len(colors) != 2 {
+			return nil, fmt.Errorf("Hires graphics need 2 colors")
+		}
+		for v, c := range colors {
+			if _, dup := values[c]; dup {
+				return nil, fmt.Errorf("Color %d is given more than once", c)
+			}
+			values[c] = v
+		}
+		return values, nil
+	}
+
+	values[0] = 0
+	next := 1
+	for _, c := range cellColors(img, img.Bounds(), bitsPerPixel(multicolor), 0) {
+		if !multicolor {
+			values[c] = 1
+		} else if next > 3 {
+			return nil, fmt.Errorf("Multicolor graphics can only have 3 colors besides black")
+		} else {
+			values[c] = next
+			next++
+		}
+	}
+	return values, nil
+}
+
+// cellColors lists the palette indexes used in the area, in order
+// and leaving out the one to skip. Transparent pixels count as black.
+func cellColors(img image.Image, area image.Rectangle, step, skip int) []int {
+	used := [16]bool{}
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x += step {
+			if i := paletteIndex(img.At(x, y)); i > 0 {
+				used[i] = true
+			} else {
+				used[0] = true
+			}
+		}
+	}
+
+	colors := []int{}
+	for i, u := range used {
+		if u && i != skip {
+			colors = append(colors, i)
+		}
+	}
+	return colors
+}
+
+// mostUsedColor is the most common palette index in
+// the image, the lowest one when there's a tie
+func mostUsedColor(img image.Image) int {
+	counts := [16]int{}
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if i := paletteIndex(img.At(x, y)); i > 0 {
+				counts[i]++
+			} else {
+				counts[0]++
+			}
+		}
+	}
+	most := 0
+	for i, count := range counts {
+		if count > counts[most] {
+			most = i
+		}
+	}
+	return most
+}
+
+// withTransparent makes transparent pixels take the value of black
+func withTransparent(values map[int]int) map[int]int {
+	if v, found := values[0]; found {
+		values[-1] = v
+	}
+	return values
+}
+
+// paletteIndex returns the closest color of the
+// palette, or -1 if the pixel is transparent
+func paletteIndex(c color.Color) int {
+	r, g, b, a := c.RGBA()
+	if a < 0x8000 {
+		return -1
+	}
+
+	best, bestDist := 0, -1
+	for i, p := range c64Palette {
+		dr := int(r>>8) - int(p.R)
+		dg := int(g>>8) - int(p.G)
+		db := int(b>>8) - int(p.B)
+		if dist := dr*dr + dg*dg + db*db; bestDist < 0 || dist < bestDist {
+			best, bestDist = i, dist
+		}
+	}
+	return best
+}
+
+// readGraphicsOptions reads the options after the file name
+// into the arguments of the operand, as the directive takes them
+func readGraphicsOptions(mnemonic string, options []string) ([]string, error) {
+	mode, colors, dedup, background := "", "", "", ""
+	for _, opt := range options {
+		lower := strings.ToLower(opt)
+		canColor := mnemonic == "./SPRITE" || mnemonic == "./CHARSET"
+		switch {
+		case canColor && lower == "multicolor" && mode == "":
+			mode = lower
+		case canColor && strings.HasPrefix(lower, "colors=") && colors == "":
+			list := strings.Split(lower[len("colors="):], ",")
+			for _, c := range list {
+				if _, err := readColor(c); err != nil {
+					return nil, err
+				}
+			}
+			colors = strings.Join(list, ",")
+		case mnemonic == "./CHARSET" && lower == "dedup" && dedup == "":
+			dedup = lower
+		case mnemonic == "./KOALA" && strings.HasPrefix(lower, "background=") && background == "":
+			c, err := readColor(lower[len("background="):])
+			if err != nil {
+				return nil, err
+			}
+			background = strconv.Itoa(c)
+		default:
+			return nil, fmt.Errorf("Unknown option %s for %s", opt, strings.ToLower(mnemonic))
+		}
+	}
+
+	switch mnemonic {
+	case "./SPRITE":
+		return []string{mode, colors}, nil
+	case "./CHARSET":
+		return []string{mode, colors, dedup}, nil
+	case "./KOALA":
+		return []string{background}, nil
+	}
+	return []string{}, nil
+}
+
+// readColor reads the index of a color of the palette
+func readColor(s string) (int, error) {
+	if v, err := strconv.Atoi(s); err == nil && v >= 0 && v < len(c64Palette) {
+		return v, nil
+	}
+	return 0, fmt.Errorf("Invalid color %s, expecting 0 to 15", s)
+}
+
+// colorList reads back the colors list of the operand
+func colorList(list string) []int {
+	colors := []int{}
+	if list == "" {
+		return colors
+	}
+	for _, c := range strings.Split(list, ",") {
+		v, _ := strconv.Atoi(c)
+		colors = append(colors, v)
+	}
+	return colors
+}
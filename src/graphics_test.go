@@ -0,0 +1,196 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeImage writes a PNG of the size with the pixels given
+// as palette indexes (-1 for transparent), the rest black
+func writeImage(t *testing.T, filename string, width, height int, pixels map[[2]int]int) {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			col := color.Color(color.Transparent)
+			if c := pixels[[2]int{x, y}]; c >= 0 {
+				col = c64Palette[c]
+			}
+			img.Set(x, y, col)
+		}
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+func TestReadGraphicsOptions(t *testing.T) {
+	var tests = []struct {
+		mnemonic string
+		options  []string
+		args     []string
+		err      string
+	}{
+		{"./SPRITE", []string{}, []string{"", ""}, ""},
+		{"./SPRITE", []string{"multicolor", "colors=0,5,2,6"}, []string{"multicolor", "0,5,2,6"}, ""},
+		{"./SPRITE", []string{"COLORS=0,1"}, []string{"", "0,1"}, ""},
+		{"./SPRITE", []string{"colors=0,16"}, nil, "Invalid color 16, expecting 0 to 15"},
+		{"./SPRITE", []string{"multicolor", "multicolor"}, nil, "Unknown option multicolor for ./sprite"},
+		{"./SPRITE", []string{"dedup"}, nil, "Unknown option dedup for ./sprite"},
+		{"./CHARSET", []string{"dedup", "multicolor"}, []string{"multicolor", "", "dedup"}, ""},
+		{"./HIRES", []string{}, []string{}, ""},
+		{"./HIRES", []string{"multicolor"}, nil, "Unknown option multicolor for ./hires"},
+		{"./KOALA", []string{"background=6"}, []string{"6"}, ""},
+		{"./KOALA", []string{"background=x"}, nil, "Invalid color x, expecting 0 to 15"},
+	}
+	for _, test := range tests {
+		args, err := readGraphicsOptions(test.mnemonic, test.options)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s %v: expected error %q but got %v", test.mnemonic, test.options, test.err, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s %v: unexpected error %s", test.mnemonic, test.options, err.Error())
+		} else if !reflect.DeepEqual(args, test.args) {
+			t.Errorf("%s %v: expected %q but got %q", test.mnemonic, test.options, test.args, args)
+		}
+	}
+}
+
+func TestConvertCharset(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "tiles.png")
+	// a blank cell, a dot, a blank cell and the dot again
+	writeImage(t, filename, 16, 16, map[[2]int]int{{8, 0}: 1, {15, 15}: 1, {0, 8}: 0})
+
+	img, err := readPNG(filename)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	var tests = []struct {
+		dedup  bool
+		count  int
+		screen []byte
+	}{
+		{false, 4, []byte{0, 1, 2, 3}},
+		{true, 3, []byte{0, 1, 0, 2}},
+	}
+	for _, test := range tests {
+		g, err := convertCharset(img, false, nil, test.dedup)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		chars := g.pieces[0].data
+		if len(chars) != charsetSize || chars[8] != 0x80 || g.values[0].value != test.count {
+			t.Errorf("expected %d characters in a 2K set but got %d", test.count, g.values[0].value)
+		}
+		if string(g.pieces[1].data) != string(test.screen) {
+			t.Errorf("expected the screen map % x but got % x", test.screen, g.pieces[1].data)
+		}
+	}
+
+	// multicolor pixels are read from the left one of each pair,
+	// the colors of the right ones don't count
+	writeImage(t, filename, 8, 8, map[[2]int]int{{0, 0}: 1, {2, 0}: 2, {4, 0}: 3, {1, 0}: 5, {3, 0}: 7})
+	img, err = readPNG(filename)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	g, err := convertCharset(img, true, nil, false)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if chars := g.pieces[0].data; chars[0] != 0x6C {
+		t.Errorf("expected the multicolor row $6c but got $%02x", chars[0])
+	}
+}
+
+func TestConvertBitmaps(t *testing.T) {
+	dir := t.TempDir()
+
+	hires := filepath.Join(dir, "hires.png")
+	writeImage(t, hires, bitmapWidth, bitmapHeight, map[[2]int]int{{0, 0}: 1, {8, 0}: 2, {9, 0}: 2, {16, 0}: 3, {17, 0}: 4, {18, 0}: 5})
+	img, err := readPNG(hires)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := convertHires(img); err == nil || err.Error() != "Cell at 16,0 has 4 colors, hires bitmaps can only have 2" {
+		t.Errorf("expected an error for a cell with 4 colors but got %v", err)
+	}
+	writeImage(t, hires, bitmapWidth, bitmapHeight, map[[2]int]int{{0, 0}: 1, {8, 0}: 2, {9, 0}: 2})
+	img, _ = readPNG(hires)
+	g, err := convertHires(img)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	bitmap, screen := g.pieces[0].data, g.pieces[1].data
+	if len(bitmap) != bitmapBytes || len(screen) != screenBytes {
+		t.Fatalf("expected a bitmap and screen RAM but got %d and %d bytes", len(bitmap), len(screen))
+	}
+	if bitmap[0] != 0x80 || bitmap[8] != 0xC0 || screen[0] != 0x10 || screen[1] != 0x20 || screen[2] != 0x00 {
+		t.Errorf("unexpected hires cells % x / % x", bitmap[0:16], screen[0:3])
+	}
+
+	koala := filepath.Join(dir, "koala.png")
+	writeImage(t, koala, koalaWidth, bitmapHeight, map[[2]int]int{{0, 0}: 2, {1, 0}: 5, {2, 0}: 7, {3, 0}: 6})
+	img, _ = readPNG(koala)
+	if _, err := convertKoala(img, -1); err == nil || !strings.Contains(err.Error(), "has 4 colors besides the background") {
+		t.Errorf("expected an error for a cell with 4 colors but got %v", err)
+	}
+	writeImage(t, koala, koalaWidth, bitmapHeight, map[[2]int]int{{0, 0}: 2, {1, 0}: 5, {3, 0}: 6})
+	img, _ = readPNG(koala)
+	if g, err = convertKoala(img, -1); err != nil {
+		t.Fatal(err.Error())
+	} else if len(g.pieces) != 4 || len(g.pieces[0].data) != bitmapBytes || len(g.pieces[2].data) != screenBytes {
+		t.Fatalf("expected the Koala layout")
+	}
+	// colors in palette order: 2 is 01, 5 is 10 and 6 is 11
+	bitmap, screen, colorRAM, bg := g.pieces[0].data, g.pieces[1].data, g.pieces[2].data, g.pieces[3].data
+	if bitmap[0] != 0x63 || screen[0] != 0x25 || colorRAM[0] != 6 || bg[0] != 0 { // 01 10 00 11
+		t.Errorf("unexpected Koala cell $%02x $%02x $%02x $%02x", bitmap[0], screen[0], colorRAM[0], bg[0])
+	}
+}
+
+func TestGraphicsInclude(t *testing.T) {
+	defer resetSymbols()
+
+	dir := t.TempDir()
+	writeImage(t, filepath.Join(dir, "tiles.png"), 16, 8, map[[2]int]int{{0, 0}: 1})
+	source := strings.Join([]string{
+		".org $2000",
+		"\tlda #tiles.cols",
+		"\tldx #tiles.count",
+		".org $2800",
+		"./charset tiles.png dedup",
+		"font ./charset tiles.png",
+	}, "\n")
+	filename := filepath.Join(dir, "graphics.asm")
+	if err := ioutil.WriteFile(filename, []byte(source), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	asm := assembleTestFile(t, filename)
+	if asm.program[3] != 2 || asm.program[5] != 2 {
+		t.Errorf("expected the map columns and character count but got % x", asm.program[2:6])
+	}
+	for name, value := range map[string]int{"tiles.chars": 0x2800, "tiles.map": 0x3000, "tiles.cols": 2, "tiles.rows": 1, "font.chars": 0x3002} {
+		if symbols[name] != value {
+			t.Errorf("expected %s = $%04x but got $%04x", name, value, symbols[name])
+		}
+	}
+	if len(asm.messages) != 1 || !strings.HasSuffix(asm.messages[0].text, ":6:font.chars at $3002 is not aligned to $0800 bytes") {
+		t.Errorf("expected a warning about the alignment but got %v", asm.messages)
+	}
+}
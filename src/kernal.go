@@ -0,0 +1,356 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Stand-ins for the KERNAL (and a few BASIC) routines that programs
+// call the most, so they can run headless. When the program counter
+// reaches one of the entry points the routine is done in Go and the
+// simulator returns to the caller as the RTS at its end would.
+//
+// The screen editor works on the default screen memory at $0400 and
+// the color memory at $D800, keeping the cursor in the same zero page
+// locations as the KERNAL does, so programs can also read or change
+// them. Everything printed is kept as PETSCII in the console too.
+// Only the cycles of the RTS at the end of the routines are counted.
+//
+// Interrupts go through the KERNAL vector at $FFFE to the handler at
+// $0314, which ends by jumping to $EA31 or $EA81 as usual. These two
+// only restore the registers, the keyboard and the clock aren't run.
+
+const (
+	screenMem    = 0x0400
+	colorMem     = 0xD800
+	screenCols   = 40
+	screenRows   = 25
+	cursorColumn = 0xD3
+	cursorRow    = 0xD6
+	reverseFlag  = 0xC7
+	textColor    = 0x0286
+	borderColor  = 0xD020
+	bgColor      = 0xD021
+
+	defaultTextColor   = 14 // light blue
+	defaultBorderColor = 14 // light blue
+	defaultBgColor     = 6  // blue
+
+	kernalIRQ      = 0xFF48
+	irqHandler     = 0x0314
+	defaultHandler = 0xEA31
+)
+
+// hook is a routine done in Go instead of running its code.
+// Routines moving the program counter have jumped somewhere
+// else, the others return as their RTS would.
+type hook struct {
+	name string
+	run  func(c *cpu)
+}
+
+// kernal keeps what the stand-ins printed
+type kernal struct {
+	console []byte
+}
+
+// installKernal sets up the hooks in the cpu and starts
+// with the colors and a cleared screen like after a reset
+func installKernal(c *cpu) *kernal {
+	k := &kernal{}
+
+	c.hooks = map[int]hook{
+		0xAB1E: {"strout", k.strout},
+		0xE544: {"clear screen", k.clearScreen},
+		0xE566: {"home", k.home},
+		0xE716: {"screen output", k.screenOutput},
+		0xEA31: {"irq return", k.irqReturn},
+		0xEA81: {"irq return", k.irqReturn},
+		0xFF48: {"irq", k.irq},
+		0xFFD2: {"chrout", k.chrout},
+		0xFFE4: {"getin", k.getin},
+		0xFFF0: {"plot", k.plot},
+	}
+
+	c.write(irqVector, byte(kernalIRQ&0xFF))
+	c.write(irqVector+1, byte(kernalIRQ>>8))
+	c.write(irqHandler, byte(defaultHandler&0xFF))
+	c.write(irqHandler+1, byte(defaultHandler>>8))
+
+	c.write(textColor, defaultTextColor)
+	c.write(borderColor, defaultBorderColor)
+	c.write(bgColor, defaultBgColor)
+	k.clearScreen(c)
+	return k
+}
+
+// chrout prints the character in A
+func (k *kernal) chrout(c *cpu) {
+	k.console = append(k.console, c.a)
+	k.print(c, c.a)
+	c.setFlag(flagC, false)
+}
+
+// screenOutput is the part of chrout for the screen
+func (k *kernal) screenOutput(c *cpu) {
+	k.chrout(c)
+}
+
+// strout prints the string ending in a 0 byte at A (low) and Y (high)
+func (k *kernal) strout(c *cpu) {
+	addr := int(c.a) | int(c.y)<<8
+	for i := 0; i < 0x10000; i++ {
+		ch := c.read(addr + i)
+		if ch == 0 {
+			break
+		}
+		k.console = append(k.console, ch)
+		k.print(c, ch)
+	}
+}
+
+// irq saves the registers and jumps to the handler at $0314
+func (k *kernal) irq(c *cpu) {
+	c.push(c.a)
+	c.push(c.x)
+	c.push(c.y)
+	c.pc = c.read16(irqHandler)
+}
+
+// irqReturn restores the registers saved by irq and returns
+func (k *kernal) irqReturn(c *cpu) {
+	c.y = c.pull()
+	c.x = c.pull()
+	c.a = c.pull()
+	c.rti()
+}
+
+// getin finds no key pressed
+func (k *kernal) getin(c *cpu) {
+	c.a = 0
+	c.setNZ(c.a)
+	c.setFlag(flagC, false)
+}
+
+// plot reads the cursor position into X (row) and Y (column) when
+// the carry is set, otherwise moves the cursor there
+func (k *kernal) plot(c *cpu) {
+	if c.flag(flagC) {
+		c.x = c.read(cursorRow)
+		c.y = c.read(cursorColumn)
+		return
+	}
+	if int(c.x) < screenRows && int(c.y) < screenCols {
+		c.write(cursorRow, c.x)
+		c.write(cursorColumn, c.y)
+	}
+}
+
+func (k *kernal) clearScreen(c *cpu) {
+	for i := 0; i < screenCols*screenRows; i++ {
+		c.write(screenMem+i, 0x20)
+		c.write(colorMem+i, c.read(textColor))
+	}
+	k.home(c)
+}
+
+func (k *kernal) home(c *cpu) {
+	c.write(cursorRow, 0)
+	c.write(cursorColumn, 0)
+}
+
+// print moves the cursor for the control codes
+// or puts the character on the screen
+func (k *kernal) print(c *cpu, ch byte) {
+	row, col := int(c.read(cursorRow)), int(c.read(cursorColumn))
+	if row >= screenRows || col >= screenCols {
+		row, col = 0, 0
+	}
+
+	switch ch {
+	case 0x0D, 0x8D: // return
+		row, col = row+1, 0
+		c.write(reverseFlag, 0)
+	case 0x11: // down
+		row++
+	case 0x91: // up
+		if row > 0 {
+			row--
+		}
+	case 0x1D: // right
+		if col++; col == screenCols {
+			row, col = row+1, 0
+		}
+	case 0x9D: // left
+		if col > 0 {
+			col--
+		} else if row > 0 {
+			row, col = row-1, screenCols-1
+		}
+	case 0x14: // delete
+		if col > 0 {
+			col--
+			c.write(screenMem+row*screenCols+col, 0x20)
+		}
+	case 0x12: // rvs on
+		c.write(reverseFlag, 1)
+	case 0x92: // rvs off
+		c.write(reverseFlag, 0)
+	case 0x13:
+		row, col = 0, 0
+	case 0x93:
+		k.clearScreen(c)
+		return
+	default:
+		if color, found := petsciiColors[ch]; found {
+			c.write(textColor, color)
+			return
+		}
+		code, printable := petsciiToScreenCode(ch)
+		if !printable {
+			return
+		}
+		if c.read(reverseFlag) != 0 {
+			code |= 0x80
+		}
+		c.write(screenMem+row*screenCols+col, code)
+		c.write(colorMem+row*screenCols+col, c.read(textColor))
+		if col++; col == screenCols {
+			row, col = row+1, 0
+		}
+	}
+
+	if row == screenRows {
+		k.scroll(c)
+		row--
+	}
+	c.write(cursorRow, byte(row))
+	c.write(cursorColumn, byte(col))
+}
+
+// scroll moves the screen up a line, clearing the last one
+func (k *kernal) scroll(c *cpu) {
+	last := screenCols * (screenRows - 1)
+	for i := 0; i < last; i++ {
+		c.write(screenMem+i, c.read(screenMem+i+screenCols))
+		c.write(colorMem+i, c.read(colorMem+i+screenCols))
+	}
+	for i := last; i < last+screenCols; i++ {
+		c.write(screenMem+i, 0x20)
+		c.write(colorMem+i, c.read(textColor))
+	}
+}
+
+// petsciiColors are the codes changing the color of the text
+var petsciiColors = map[byte]byte{
+	0x90: 0, 0x05: 1, 0x1C: 2, 0x9F: 3, 0x9C: 4, 0x1E: 5, 0x1F: 6, 0x9E: 7,
+	0x81: 8, 0x95: 9, 0x96: 10, 0x97: 11, 0x98: 12, 0x99: 13, 0x9A: 14, 0x9B: 15,
+}
+
+// petsciiToScreenCode returns the screen code for a
+// printable character, false for the control codes
+func petsciiToScreenCode(ch byte) (byte, bool) {
+	switch {
+	case ch >= 0x20 && ch <= 0x3F:
+		return ch, true
+	case ch >= 0x40 && ch <= 0x5F:
+		return ch - 0x40, true
+	case ch >= 0x60 && ch <= 0x7F:
+		return ch - 0x20, true
+	case ch >= 0xA0 && ch <= 0xBF:
+		return ch - 0x40, true
+	case ch >= 0xC0 && ch <= 0xFE:
+		return ch - 0x80, true
+	case ch == 0xFF:
+		return 0x5E, true
+	}
+	return 0, false
+}
+
+// petsciiToText decodes PETSCII as shown with the default
+// upper case and graphics character set. Control codes are
+// written with their names between braces, like `{clr}`, and
+// the graphic characters with their values, like `{$c1}`.
+func petsciiToText(codes []byte) string {
+	names := petsciiControlNames()
+	var text strings.Builder
+	for _, ch := range codes {
+		switch {
+		case ch == 0x0D:
+			text.WriteByte('\n')
+		case ch == 0x5C:
+			text.WriteString("£")
+		case ch == 0x5E:
+			text.WriteString("↑")
+		case ch == 0x5F:
+			text.WriteString("←")
+		case ch >= 0x20 && ch <= 0x5D:
+			text.WriteByte(ch)
+		case ch == 0xA0:
+			text.WriteByte(' ')
+		case names[ch] != "":
+			fmt.Fprintf(&text, "{%s}", names[ch])
+		default:
+			fmt.Fprintf(&text, "{$%02x}", ch)
+		}
+	}
+	return text.String()
+}
+
+// petsciiControlNames picks the shortest name of each control code
+func petsciiControlNames() map[byte]string {
+	all := []string{}
+	for name := range petsciiControlCodes {
+		all = append(all, name)
+	}
+	sort.Strings(all)
+
+	names := map[byte]string{}
+	for _, name := range all {
+		code := petsciiControlCodes[name]
+		if prev, found := names[code]; !found || len(name) < len(prev) {
+			names[code] = name
+		}
+	}
+	return names
+}
+
+// screenText reads the screen memory as text, one line per row
+// without the spaces at the end and the empty rows at the bottom.
+// Reversed characters show as the normal ones and graphics as `#`.
+func screenText(c *cpu) string {
+	lines := make([]string, screenRows)
+	for row := range lines {
+		line := make([]rune, screenCols)
+		for col := range line {
+			line[col] = screenCodeToRune(c.read(screenMem + row*screenCols + col))
+		}
+		lines[row] = strings.TrimRight(string(line), " ")
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+func screenCodeToRune(code byte) rune {
+	switch code &= 0x7F; {
+	case code == 0x00:
+		return '@'
+	case code <= 0x1A:
+		return rune('A' + code - 1)
+	case code == 0x1B:
+		return '['
+	case code == 0x1C:
+		return '£'
+	case code == 0x1D:
+		return ']'
+	case code == 0x1E:
+		return '↑'
+	case code == 0x1F:
+		return '←'
+	case code <= 0x3F:
+		return rune(code)
+	case code == 0x60:
+		return ' '
+	}
+	return '#'
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKernalPrint(t *testing.T) {
+	var tests = []struct {
+		printed []byte
+		console string
+		screen  string
+	}{
+		{[]byte{0x48, 0x49}, "HI", "HI"},
+		{[]byte{0x93, 0x41, 0x0D, 0x42}, "{clr}A\nB", "A\nB"},
+		{[]byte{0x41, 0x11, 0x1D, 0x42, 0x13, 0x43}, "A{down}{rght}B{home}C", "C\n  B"},
+		{[]byte{0x41, 0x42, 0x14, 0x9D, 0x43}, "AB{del}{left}C", "C"},
+		{[]byte{0x12, 0x41, 0x92, 0x5C, 0x5F, 0xC1}, "{rvson}A{rvsoff}£←{$c1}", "A£←#"},
+		{[]byte{0x1C, 0x31, 0x05, 0x8D}, "{red}1{wht}{$8d}", "1"},
+	}
+
+	for _, test := range tests {
+		c := newCPU()
+		k := installKernal(c)
+		for _, ch := range test.printed {
+			c.a = ch
+			k.chrout(c)
+		}
+		if console := petsciiToText(k.console); console != test.console {
+			t.Errorf("expected console %q for % x but got %q", test.console, test.printed, console)
+		}
+		if screen := screenText(c); screen != test.screen {
+			t.Errorf("expected screen %q for % x but got %q", test.screen, test.printed, screen)
+		}
+	}
+}
+
+func TestKernalScreen(t *testing.T) {
+	c := newCPU()
+	k := installKernal(c)
+
+	// a full line wraps and the screen scrolls at the bottom
+	for row := 0; row < screenRows; row++ {
+		for i := 0; i < screenCols; i++ {
+			c.a = byte('A' + row%26)
+			k.chrout(c)
+		}
+	}
+	lines := strings.Split(screenText(c), "\n")
+	if len(lines) != screenRows-1 || lines[0] != strings.Repeat("B", screenCols) {
+		t.Errorf("expected the screen scrolled a line but got:\n%s", screenText(c))
+	}
+	if c.read(cursorRow) != screenRows-1 || c.read(cursorColumn) != 0 {
+		t.Errorf("expected cursor at the start of the last line but got %d,%d", c.read(cursorRow), c.read(cursorColumn))
+	}
+
+	// colors and reverse go to the color memory and screen codes
+	c.a = 0x1C
+	k.chrout(c)
+	c.a = 0x12
+	k.chrout(c)
+	c.a = 0x41
+	k.chrout(c)
+	last := (screenRows - 1) * screenCols
+	if c.read(screenMem+last) != 0x81 || c.read(colorMem+last) != 2 {
+		t.Errorf("expected reversed A in red but got $%02x in color %d", c.read(screenMem+last), c.read(colorMem+last))
+	}
+
+	// plot moves and reads the cursor
+	c.x, c.y = 3, 7
+	c.setFlag(flagC, false)
+	k.plot(c)
+	c.x, c.y = 0, 0
+	c.setFlag(flagC, true)
+	k.plot(c)
+	if c.x != 3 || c.y != 7 {
+		t.Errorf("expected plot to read 3,7 but got %d,%d", c.x, c.y)
+	}
+}
+
+func TestKernalHooks(t *testing.T) {
+	defer resetSymbols()
+
+	asm := assembleTestFile(t, "../examples/001_printx.asm")
+	c := newCPU()
+	k := installKernal(c)
+	c.load(asm.program)
+
+	stop, err := runRoutine(c, asm.startAddr, defaultCycleLimit, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if stop != "rts at $c008" || c.cycles != 32 {
+		t.Errorf("expected rts at $c008 after 32 cycles but got %s after %d", stop, c.cycles)
+	}
+	if console := petsciiToText(k.console); console != "X" {
+		t.Errorf("expected X printed but got %q", console)
+	}
+}
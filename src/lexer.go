@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Strings in the sources go between double quotes, with a backslash
+// before the characters that would otherwise end or change them: `\"`
+// for a quote, `\\` for a backslash and `\{` or `\}` for braces that
+// are not a control code. Semicolons inside a string are part of it,
+// only the ones outside strings start a comment.
+
+// stripComment returns the line without its comment, failing
+// if a string in it is missing its closing quote
+func stripComment(line string) (string, error) {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case ';':
+			return line[:i], nil
+		case '"':
+			end, err := scanString(line, i)
+			if err != nil {
+				return "", err
+			}
+			i = end - 1
+		}
+	}
+	return line, nil
+}
+
+// scanString finds the end of the string starting with the
+// quote at start, returning the index after its closing quote
+func scanString(line string, start int) (int, error) {
+	for i := start + 1; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("Unterminated string starting at column %d", start+1)
+}
+
+func isEscapable(c byte) bool {
+	return c == '"' || c == '\\' || c == '{' || c == '}'
+}
+
+// checkEscapes fails on the first backslash in a string of the
+// line that is not followed by a character it can escape
+func checkEscapes(line string) error {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '"':
+			quoted = !quoted
+		case line[i] == '\\' && quoted:
+			if i+1 < len(line) && !isEscapable(line[i+1]) {
+				return escapeError(line, i)
+			}
+			i++
+		}
+	}
+	return nil
+}
+
+// escapeError reports the escape starting with the backslash at s[i]
+func escapeError(s string, i int) error {
+	_, size := utf8.DecodeRuneInString(s[i+1:])
+	return fmt.Errorf("Unknown escape %s at column %d, expecting \\\", \\\\, \\{ or \\}", s[i:i+1+size], i+1)
+}
+
+// unescape drops the backslashes before the escaped characters,
+// the columns of its errors count from the start of the text
+func unescape(s string) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+	var text strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			if i+1 == len(s) || !isEscapable(s[i+1]) {
+				return "", escapeError(s, i)
+			}
+			i++
+		}
+		text.WriteByte(s[i])
+	}
+	return text.String(), nil
+}
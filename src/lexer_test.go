@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStripComment(t *testing.T) {
+	var tests = []struct {
+		line     string
+		expected string
+		err      string
+	}{
+		{"\tlda #1 ; comment", "\tlda #1 ", ""},
+		{".text \"HELLO; WORLD\" ; greeting", ".text \"HELLO; WORLD\" ", ""},
+		{".text \"say \\\"hi\\\"; bye\"", ".text \"say \\\"hi\\\"; bye\"", ""},
+		{".text \"back\\\\\"; slash", ".text \"back\\\\\"", ""},
+		{".print \"a\", \"b;c\";", ".print \"a\", \"b;c\"", ""},
+		{"msg .text \"HELLO", "", "Unterminated string starting at column 11"},
+		{".text \"HELLO\\\"", "", "Unterminated string starting at column 7"},
+	}
+	for _, test := range tests {
+		actual, err := stripComment(test.line)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s: expected error %q but got %v", test.line, test.err, err)
+			}
+		} else if err != nil || actual != test.expected {
+			t.Errorf("%s: expected %q but got %q (%v)", test.line, test.expected, actual, err)
+		}
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	var tests = []struct {
+		text     string
+		expected string
+		err      string
+	}{
+		{`plain`, `plain`, ""},
+		{`say \"hi\" \\ \{clr\}`, `say "hi" \ {clr}`, ""},
+		{`a\nb`, "", `Unknown escape \n at column 2, expecting \", \\, \{ or \}`},
+		{`end\`, "", `Unknown escape \ at column 4, expecting \", \\, \{ or \}`},
+	}
+	for _, test := range tests {
+		actual, err := unescape(test.text)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s: expected error %q but got %v", test.text, test.err, err)
+			}
+		} else if err != nil || actual != test.expected {
+			t.Errorf("%s: expected %q but got %q (%v)", test.text, test.expected, actual, err)
+		}
+	}
+}
+
+func TestSplitTokensStrings(t *testing.T) {
+	var tests = []struct {
+		line     string
+		expected []string
+	}{
+		{"msg .text \"HELLO WORLD\"", []string{"msg", ".text", "HELLO WORLD"}},
+		{".text \"say \\\"hi\\\"\"", []string{".text", "say \\\"hi\\\""}},
+		{".text \"\"", []string{".text", ""}},
+		{".text \"a\" \"b\"", []string{".text", "a", "b"}},
+		{".text \"open", []string{".text", "open"}},
+	}
+	for _, test := range tests {
+		if actual := splitTokens(test.line); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%s: expected %q but got %q", test.line, test.expected, actual)
+		}
+	}
+}
+
+func TestStringsInSources(t *testing.T) {
+	defer resetSymbols()
+
+	var tests = []struct {
+		lines    []string
+		expected []byte
+		err      string
+	}{
+		{[]string{".ascii \"HELLO; WORLD\" ; comment"}, []byte("HELLO; WORLD"), ""},
+		{[]string{".ascii \"say \\\"hi\\\"\""}, []byte("say \"hi\""), ""},
+		{[]string{".ascii \"\\\\ \\{clr\\}\""}, []byte("\\ {clr}"), ""},
+		{[]string{".ascii \"a\\n\""}, nil, ":2:Unknown escape \\n at column 10, expecting \\\", \\\\, \\{ or \\}"},
+		{[]string{"\t.print \"tab\\q\""}, nil, ":2:Unknown escape \\q at column 13, expecting \\\", \\\\, \\{ or \\}"},
+		{[]string{".ascii \"ok\"", ".test out", "\t.expect output = \"{return}\"", ".end"}, []byte("ok"), ""},
+		{[]string{".test out", "\t.expect output = \"\\n\"", ".end"}, nil, ":3:Unknown escape \\n at column 20, expecting \\\", \\\\, \\{ or \\}"},
+		{[]string{"\tnop", ".ascii \"HELLO"}, nil, ":3:Unterminated string starting at column 8"},
+	}
+
+	for i, test := range tests {
+		asm, err := assembleLines(t, append([]string{"\t.org $2000"}, test.lines...))
+
+		if test.err != "" {
+			if err == nil || !strings.HasSuffix(err.Error(), test.err) {
+				t.Errorf("test %d: expected error %s but got %v", i, test.err, err)
+			}
+		} else if err != nil {
+			t.Errorf("test %d: unexpected error %s", i, err.Error())
+		} else if !bytes.Equal(asm.program[2:], test.expected) {
+			t.Errorf("test %d: expected % x but got % x", i, test.expected, asm.program[2:])
+		}
+	}
+}
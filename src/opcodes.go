@@ -5,9 +5,10 @@ import (
 )
 
 type opcode struct {
-	// Currently only the `hex` and `len` members
-	// of this structure are used, the others are
-	// included for possible future expansion.
+	// `cycles` is the base count of cycles taken,
+	// `crossesPage` tells if it takes one more when
+	// an indexed address crosses a page (for branches
+	// taken it's the extra one for a different page)
 	mnemonic    string
 	mode        string
 	hex         uint8
@@ -42,14 +43,78 @@ var pseudoOpcodes map[string]opcode = map[string]opcode{
 	// .ORG
 	".ORG": opcode{mnemonic: ".ORG", mode: NOMODE},
 
-	// .TEXT
-	".TEXT": opcode{mnemonic: ".TEXT", mode: NOMODE},
+	// .BANK
+	".BANK": opcode{mnemonic: ".BANK", mode: NOMODE},
+
+	// .TEXT, .SCR, .PETSCII and .ASCII
+	".TEXT":    opcode{mnemonic: ".TEXT", mode: NOMODE},
+	".SCR":     opcode{mnemonic: ".SCR", mode: NOMODE},
+	".PETSCII": opcode{mnemonic: ".PETSCII", mode: NOMODE},
+	".ASCII":   opcode{mnemonic: ".ASCII", mode: NOMODE},
+
+	// .CSTRING, .PSTRING and .HSTRING (ended with 0, after
+	// their length or with the high bit of the last byte set)
+	".CSTRING": opcode{mnemonic: ".CSTRING", mode: NOMODE},
+	".PSTRING": opcode{mnemonic: ".PSTRING", mode: NOMODE},
+	".HSTRING": opcode{mnemonic: ".HSTRING", mode: NOMODE},
+
+	// .TEXTMODE, .CHARMAP and .ENCODING (how the text is written)
+	".TEXTMODE": opcode{mnemonic: ".TEXTMODE", mode: NOMODE},
+	".CHARMAP":  opcode{mnemonic: ".CHARMAP", mode: NOMODE},
+	".ENCODING": opcode{mnemonic: ".ENCODING", mode: NOMODE},
 
 	// DFB
 	"DFB": opcode{mnemonic: "DFB", mode: NOMODE},
 
 	// ./BIN
 	"./BIN": opcode{mnemonic: "./BIN", mode: NOMODE},
+
+	// ./SID (music at its own load address)
+	"./SID": opcode{mnemonic: "./SID", mode: NOMODE},
+
+	// ./SPRITE (sprites from a PNG sheet)
+	"./SPRITE": opcode{mnemonic: "./SPRITE", mode: NOMODE},
+
+	// ./CHARSET, ./HIRES and ./KOALA (graphics from PNG images)
+	"./CHARSET": opcode{mnemonic: "./CHARSET", mode: NOMODE},
+	"./HIRES":   opcode{mnemonic: "./HIRES", mode: NOMODE},
+	"./KOALA":   opcode{mnemonic: "./KOALA", mode: NOMODE},
+
+	// ./BASIC
+	"./BASIC": opcode{mnemonic: "./BASIC", mode: NOMODE},
+
+	// ./DISK (file for the disk image)
+	"./DISK": opcode{mnemonic: "./DISK", mode: NOMODE},
+
+	// .BREAK and .WATCH (debugging checkpoints)
+	".BREAK": opcode{mnemonic: ".BREAK", mode: NOMODE},
+	".WATCH": opcode{mnemonic: ".WATCH", mode: NOMODE},
+
+	// .TEST blocks and their steps
+	".TEST":   opcode{mnemonic: ".TEST", mode: NOMODE},
+	".SET":    opcode{mnemonic: ".SET", mode: NOMODE},
+	".CALL":   opcode{mnemonic: ".CALL", mode: NOMODE},
+	".EXPECT": opcode{mnemonic: ".EXPECT", mode: NOMODE},
+
+	// .ASSERT, .ERROR, .WARNING and .PRINT (checked after the layout)
+	".ASSERT":  opcode{mnemonic: ".ASSERT", mode: NOMODE},
+	".ERROR":   opcode{mnemonic: ".ERROR", mode: NOMODE},
+	".WARNING": opcode{mnemonic: ".WARNING", mode: NOMODE},
+	".PRINT":   opcode{mnemonic: ".PRINT", mode: NOMODE},
+
+	// .SPRITE and .CHAR (rows of pixels until .END)
+	".SPRITE": opcode{mnemonic: ".SPRITE", mode: NOMODE},
+	".CHAR":   opcode{mnemonic: ".CHAR", mode: NOMODE},
+
+	// .NOPAGECROSS and .TIMED blocks (checked after the layout)
+	".NOPAGECROSS": opcode{mnemonic: ".NOPAGECROSS", mode: NOMODE},
+	".TIMED":       opcode{mnemonic: ".TIMED", mode: NOMODE},
+
+	// .END closes a block
+	".END": opcode{mnemonic: ".END", mode: NOMODE},
+
+	// .BASIC_SYS (BASIC line to start the program)
+	".BASIC_SYS": opcode{mnemonic: ".BASIC_SYS", mode: NOMODE, len: basicSysLen},
 }
 
 var opcodes map[string]opcode = map[string]opcode{
@@ -105,7 +170,7 @@ var opcodes map[string]opcode = map[string]opcode{
 	"BVC-" + RL: opcode{"BVC", RL, 0x50, 2, 2, true},
 	"BVS-" + RL: opcode{"BVS", RL, 0x70, 2, 2, true},
 	"BCC-" + RL: opcode{"BCC", RL, 0x90, 2, 2, true},
-	"BCS-" + RL: opcode{"BCS", RL, 0x80, 2, 2, true},
+	"BCS-" + RL: opcode{"BCS", RL, 0xB0, 2, 2, true},
 	"BNE-" + RL: opcode{"BNE", RL, 0xD0, 2, 2, true},
 	"BEQ-" + RL: opcode{"BEQ", RL, 0xF0, 2, 2, true},
 
@@ -163,19 +228,19 @@ var opcodes map[string]opcode = map[string]opcode{
 	//
 	// Flag (Processor Status) Instructions
 	//
-	"CLC-" + IMP: opcode{"CLC", IY, 0x18, 1, 2, true}, // CLear Carry
-	"SEC-" + IMP: opcode{"SEC", IY, 0x38, 1, 2, true}, // SEt Carry
-	"CLI-" + IMP: opcode{"CLI", IY, 0x58, 1, 2, true}, // CLear Interrupt
-	"SEI-" + IMP: opcode{"SEI", IY, 0x78, 1, 2, true}, // SEt Interrupt
-	"CLV-" + IMP: opcode{"CLV", IY, 0xB8, 1, 2, true}, // CLear oVerflow
-	"CLD-" + IMP: opcode{"CLD", IY, 0xD8, 1, 2, true}, // CLear Decimal
-	"SED-" + IMP: opcode{"SED", IY, 0xF8, 1, 2, true}, // SEt Decimal
+	"CLC-" + IMP: opcode{"CLC", IMP, 0x18, 1, 2, false}, // CLear Carry
+	"SEC-" + IMP: opcode{"SEC", IMP, 0x38, 1, 2, false}, // SEt Carry
+	"CLI-" + IMP: opcode{"CLI", IMP, 0x58, 1, 2, false}, // CLear Interrupt
+	"SEI-" + IMP: opcode{"SEI", IMP, 0x78, 1, 2, false}, // SEt Interrupt
+	"CLV-" + IMP: opcode{"CLV", IMP, 0xB8, 1, 2, false}, // CLear oVerflow
+	"CLD-" + IMP: opcode{"CLD", IMP, 0xD8, 1, 2, false}, // CLear Decimal
+	"SED-" + IMP: opcode{"SED", IMP, 0xF8, 1, 2, false}, // SEt Decimal
 
 	//
 	// INC (INCrement memory)
 	//
 	"INC-" + ZP:   opcode{"INC", ZP, 0xE6, 2, 5, false},
-	"INC-" + ZPX:  opcode{"INC", ZPX, 0xF6, 2, 5, false},
+	"INC-" + ZPX:  opcode{"INC", ZPX, 0xF6, 2, 6, false},
 	"INC-" + ABS:  opcode{"INC", ABS, 0xEE, 3, 6, false},
 	"INC-" + ABSX: opcode{"INC", ABSX, 0xFE, 3, 7, false},
 
@@ -216,21 +281,21 @@ var opcodes map[string]opcode = map[string]opcode{
 	//
 	"LDY-" + IM:   opcode{"LDY", IM, 0xA0, 2, 2, false},
 	"LDY-" + ZP:   opcode{"LDY", ZP, 0xA4, 2, 3, false},
-	"LDY-" + ZPX:  opcode{"LDY", ZPY, 0xB4, 2, 4, false},
+	"LDY-" + ZPX:  opcode{"LDY", ZPX, 0xB4, 2, 4, false},
 	"LDY-" + ABS:  opcode{"LDY", ABS, 0xAC, 3, 4, false},
-	"LDY-" + ABSX: opcode{"LDY", ABSY, 0xBC, 3, 4, true},
+	"LDY-" + ABSX: opcode{"LDY", ABSX, 0xBC, 3, 4, true},
 
 	//
 	// LSR (Logical Shift Right)
 	//
 	"LSR-" + ACC:  opcode{"LSR", ACC, 0x4A, 1, 2, false},
 	"LSR-" + ZP:   opcode{"LSR", ZP, 0x46, 2, 5, false},
-	"LSR-" + ZPX:  opcode{"LSR", ZPY, 0x56, 2, 6, false},
+	"LSR-" + ZPX:  opcode{"LSR", ZPX, 0x56, 2, 6, false},
 	"LSR-" + ABS:  opcode{"LSR", ABS, 0x4E, 3, 6, false},
-	"LSR-" + ABSX: opcode{"LSR", ABSY, 0x5E, 3, 7, false},
+	"LSR-" + ABSX: opcode{"LSR", ABSX, 0x5E, 3, 7, false},
 
 	// NOP (No OPeration)
-	"NOP-" + IMP: opcode{"NOP", ABSY, 0xEA, 1, 2, false},
+	"NOP-" + IMP: opcode{"NOP", IMP, 0xEA, 1, 2, false},
 
 	//
 	// ORA (bitwise OR with Accumulator)
@@ -247,32 +312,32 @@ var opcodes map[string]opcode = map[string]opcode{
 	//
 	// Register Instructions
 	//
-	"TAX-" + IMP: opcode{"TAX", IMP, 0xAA, 1, 2, true}, // Transfer A to X
-	"TXA-" + IMP: opcode{"TXA", IMP, 0x8A, 1, 2, true}, // Transfer X to A
-	"DEX-" + IMP: opcode{"DEX", IMP, 0xCA, 1, 2, true}, // DEcrement X
-	"INX-" + IMP: opcode{"INX", IMP, 0xE8, 1, 2, true}, // INcrement X
-	"TAY-" + IMP: opcode{"TAY", IMP, 0xA8, 1, 2, true}, // Transfer A to Y
-	"TYA-" + IMP: opcode{"TYA", IMP, 0x98, 1, 2, true}, // Transfer Y to A
-	"DEY-" + IMP: opcode{"DEY", IMP, 0x88, 1, 2, true}, // DEcrement Y
-	"INY-" + IMP: opcode{"INY", IMP, 0xC8, 1, 2, true}, // INcrement Y
+	"TAX-" + IMP: opcode{"TAX", IMP, 0xAA, 1, 2, false}, // Transfer A to X
+	"TXA-" + IMP: opcode{"TXA", IMP, 0x8A, 1, 2, false}, // Transfer X to A
+	"DEX-" + IMP: opcode{"DEX", IMP, 0xCA, 1, 2, false}, // DEcrement X
+	"INX-" + IMP: opcode{"INX", IMP, 0xE8, 1, 2, false}, // INcrement X
+	"TAY-" + IMP: opcode{"TAY", IMP, 0xA8, 1, 2, false}, // Transfer A to Y
+	"TYA-" + IMP: opcode{"TYA", IMP, 0x98, 1, 2, false}, // Transfer Y to A
+	"DEY-" + IMP: opcode{"DEY", IMP, 0x88, 1, 2, false}, // DEcrement Y
+	"INY-" + IMP: opcode{"INY", IMP, 0xC8, 1, 2, false}, // INcrement Y
 
 	//
 	// ROL (ROtate Left)
 	//
 	"ROL-" + ACC:  opcode{"ROL", ACC, 0x2A, 1, 2, false},
 	"ROL-" + ZP:   opcode{"ROL", ZP, 0x26, 2, 5, false},
-	"ROL-" + ZPX:  opcode{"ROL", ZPY, 0x36, 2, 6, false},
+	"ROL-" + ZPX:  opcode{"ROL", ZPX, 0x36, 2, 6, false},
 	"ROL-" + ABS:  opcode{"ROL", ABS, 0x2E, 3, 6, false},
-	"ROL-" + ABSX: opcode{"ROL", ABSY, 0x3E, 3, 7, false},
+	"ROL-" + ABSX: opcode{"ROL", ABSX, 0x3E, 3, 7, false},
 
 	//
 	// ROR (ROtate Right)
 	//
 	"ROR-" + ACC:  opcode{"ROR", ACC, 0x6A, 1, 2, false},
 	"ROR-" + ZP:   opcode{"ROR", ZP, 0x66, 2, 5, false},
-	"ROR-" + ZPX:  opcode{"ROR", ZPY, 0x76, 2, 6, false},
+	"ROR-" + ZPX:  opcode{"ROR", ZPX, 0x76, 2, 6, false},
 	"ROR-" + ABS:  opcode{"ROR", ABS, 0x6E, 3, 6, false},
-	"ROR-" + ABSX: opcode{"ROR", ABSY, 0x7E, 3, 7, false},
+	"ROR-" + ABSX: opcode{"ROR", ABSX, 0x7E, 3, 7, false},
 
 	//
 	// RTI (ReTurn from Interrupt)
@@ -310,25 +375,25 @@ var opcodes map[string]opcode = map[string]opcode{
 	//
 	// Stack Instructions
 	//
-	"TXS-" + IMP: opcode{"TXS", IMP, 0x9A, 1, 2, true}, // Transfer X to Stack ptr
-	"TSX-" + IMP: opcode{"TSX", IMP, 0xBA, 1, 2, true}, // Transfer Stack ptr to X
-	"PHA-" + IMP: opcode{"PHA", IMP, 0x48, 1, 3, true}, // PusH Accumulator
-	"PLA-" + IMP: opcode{"PLA", IMP, 0x68, 1, 4, true}, // PuLl Accumulator
-	"PHP-" + IMP: opcode{"PHP", IMP, 0x08, 1, 3, true}, // PusH Processor status
-	"PLP-" + IMP: opcode{"PLP", IMP, 0x28, 1, 4, true}, // PuLl Processor status
+	"TXS-" + IMP: opcode{"TXS", IMP, 0x9A, 1, 2, false}, // Transfer X to Stack ptr
+	"TSX-" + IMP: opcode{"TSX", IMP, 0xBA, 1, 2, false}, // Transfer Stack ptr to X
+	"PHA-" + IMP: opcode{"PHA", IMP, 0x48, 1, 3, false}, // PusH Accumulator
+	"PLA-" + IMP: opcode{"PLA", IMP, 0x68, 1, 4, false}, // PuLl Accumulator
+	"PHP-" + IMP: opcode{"PHP", IMP, 0x08, 1, 3, false}, // PusH Processor status
+	"PLP-" + IMP: opcode{"PLP", IMP, 0x28, 1, 4, false}, // PuLl Processor status
 
 	//
 	// STX (STore X register)
 	//
 	"STX-" + ZP:  opcode{"STX", ZP, 0x86, 2, 3, false},
-	"STX-" + ZPY: opcode{"STX", ZPX, 0x96, 2, 4, false},
+	"STX-" + ZPY: opcode{"STX", ZPY, 0x96, 2, 4, false},
 	"STX-" + ABS: opcode{"STX", ABS, 0x8E, 3, 4, false},
 
 	//
 	// STY (STore Y register)
 	//
 	"STY-" + ZP:  opcode{"STY", ZP, 0x84, 2, 3, false},
-	"STY-" + ZPY: opcode{"STY", ZPX, 0x94, 2, 4, false},
+	"STY-" + ZPX: opcode{"STY", ZPX, 0x94, 2, 4, false},
 	"STY-" + ABS: opcode{"STY", ABS, 0x8C, 3, 4, false},
 }
 
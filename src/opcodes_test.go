@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestOpcodeHex(t *testing.T) {
+	tests := []struct {
+		mnemonic string
+		mode     string
+		hex      uint8
+	}{
+		{"BCC", RL, 0x90},
+		{"BCS", RL, 0xB0},
+		{"BNE", RL, 0xD0},
+		{"STX", ZPY, 0x96},
+		{"STY", ZPX, 0x94},
+	}
+	for _, test := range tests {
+		opc, err := readOpcode(test.mnemonic, test.mode)
+		if err != nil {
+			t.Errorf("%s (%s): unexpected error %s", test.mnemonic, test.mode, err.Error())
+		} else if opc.hex != test.hex {
+			t.Errorf("%s (%s): expected $%02x but got $%02x", test.mnemonic, test.mode, test.hex, opc.hex)
+		}
+	}
+}
+
+func TestOpcodeMissingModes(t *testing.T) {
+	tests := []struct {
+		mnemonic string
+		mode     string
+	}{
+		{"STX", ZPX},
+		{"STY", ZPY},
+		{"LDA", IND},
+	}
+	for _, test := range tests {
+		if _, err := readOpcode(test.mnemonic, test.mode); err == nil {
+			t.Errorf("%s (%s): expected an invalid opcode", test.mnemonic, test.mode)
+		}
+	}
+}
+
+func TestOpcodeModes(t *testing.T) {
+	for key, opc := range opcodes {
+		if key != opc.mnemonic+"-"+opc.mode {
+			t.Errorf("%s: mode of the opcode is %s", key, opc.mode)
+		}
+	}
+}
+
+func TestOpcodePageCrossing(t *testing.T) {
+	// only indexed addresses and branches
+	// can take a cycle more on a new page
+	for key, opc := range opcodes {
+		if opc.crossesPage && (opc.mode == IMP || opc.mode == ACC) {
+			t.Errorf("%s: can't cross a page", key)
+		}
+	}
+}
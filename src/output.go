@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// outputFormat builds the contents of the output
+// file from an assembled program
+type outputFormat func(asm *assembly, opts outputOptions) ([]byte, error)
+
+// outputOptions are the settings given in the
+// command line for some of the output formats
+type outputOptions struct {
+	crtType string
+	crtName string
+
+	sidInit      string
+	sidPlay      string
+	sidSongs     int
+	sidStartSong int
+	sidTitle     string
+	sidAuthor    string
+	sidReleased  string
+	sidSpeed     string
+	sidClock     string
+	sidModel     string
+}
+
+var outputFormats = map[string]outputFormat{
+	"prg":  formatPRG,
+	"raw":  formatRaw,
+	"ihex": formatIntelHex,
+	"srec": formatSRecord,
+	"crt":  formatCRT,
+	"psid": formatPSID,
+}
+
+// errBanked is returned by the formats that
+// cannot hold more than a single bank
+var errBanked = fmt.Errorf("Program uses more than one bank, it can only be written as a cartridge")
+
+// chunk is a run of contiguous bytes of the
+// program to be loaded at a given address
+type chunk struct {
+	addr int
+	data []byte
+}
+
+// chunks returns the actual data of the program, without the
+// padding between segments, sorted by address. Adjacent
+// segments are merged into a single chunk.
+func (asm *assembly) chunks() []chunk {
+	return chunksOf(asm.startAddr, asm.segments, asm.program[2:])
+}
+
+// chunksOf takes the chunks of the segments
+// from an image starting at the given address
+func chunksOf(start int, segs []segment, image []byte) []chunk {
+
+	type span struct{ start, end int }
+	spans := []span{}
+
+	for _, seg := range segs {
+		if len(seg.partiallyAssembled) == 0 {
+			continue
+		}
+		first := seg.partiallyAssembled[0]
+		last := seg.partiallyAssembled[len(seg.partiallyAssembled)-1]
+		spans = append(spans, span{first.addr, last.addr + last.size()})
+	}
+
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].start < spans[j].start
+	})
+
+	chunks := []chunk{}
+	for _, s := range spans {
+		data := image[s.start-start : s.end-start]
+		if last := len(chunks) - 1; last >= 0 && chunks[last].addr+len(chunks[last].data) == s.start {
+			chunks[last].data = append(chunks[last].data, data...)
+			continue
+		}
+		chunks = append(chunks, chunk{addr: s.start, data: append([]byte{}, data...)})
+	}
+	return chunks
+}
+
+// formatPRG is the C64 program file: the load
+// address followed by the padded segments
+func formatPRG(asm *assembly, opts outputOptions) ([]byte, error) {
+	if asm.program == nil {
+		return nil, errBanked
+	}
+	return asm.program, nil
+}
+
+// formatRaw is the same as a PRG without the load address
+func formatRaw(asm *assembly, opts outputOptions) ([]byte, error) {
+	if asm.program == nil {
+		return nil, errBanked
+	}
+	return asm.program[2:], nil
+}
+
+// formatIntelHex writes each chunk as Intel HEX data
+// records of up to 16 bytes, plus the end of file record
+func formatIntelHex(asm *assembly, opts outputOptions) ([]byte, error) {
+
+	const recordLen = 16
+
+	if asm.program == nil {
+		return nil, errBanked
+	}
+
+	buffer := new(bytes.Buffer)
+
+	writeRecord := func(addr int, rtype byte, data []byte) {
+		sum := byte(len(data)) + byte(addr>>8) + byte(addr) + rtype
+		fmt.Fprintf(buffer, ":%02X%04X%02X", len(data), addr, rtype)
+		for _, b := range data {
+			fmt.Fprintf(buffer, "%02X", b)
+			sum += b
+		}
+		fmt.Fprintf(buffer, "%02X\n", byte(-sum))
+	}
+
+	for _, c := range asm.chunks() {
+		for i := 0; i < len(c.data); i += recordLen {
+			end := i + recordLen
+			if end > len(c.data) {
+				end = len(c.data)
+			}
+			writeRecord(c.addr+i, 0x00, c.data[i:end])
+		}
+	}
+	writeRecord(0, 0x01, nil)
+
+	return buffer.Bytes(), nil
+}
+
+// formatSRecord writes each chunk as Motorola S1 records of up to 16
+// bytes, with a S0 header, a S5 record count and S9 for the start address
+func formatSRecord(asm *assembly, opts outputOptions) ([]byte, error) {
+
+	const recordLen = 16
+
+	if asm.program == nil {
+		return nil, errBanked
+	}
+
+	buffer := new(bytes.Buffer)
+
+	writeRecord := func(rtype string, addr int, data []byte) {
+		count := len(data) + 3 // address and checksum
+		sum := byte(count) + byte(addr>>8) + byte(addr)
+		fmt.Fprintf(buffer, "%s%02X%04X", rtype, count, addr)
+		for _, b := range data {
+			fmt.Fprintf(buffer, "%02X", b)
+			sum += b
+		}
+		fmt.Fprintf(buffer, "%02X\n", ^sum)
+	}
+
+	writeRecord("S0", 0, []byte("xbbasm"))
+
+	records := 0
+	for _, c := range asm.chunks() {
+		for i := 0; i < len(c.data); i += recordLen {
+			end := i + recordLen
+			if end > len(c.data) {
+				end = len(c.data)
+			}
+			writeRecord("S1", c.addr+i, c.data[i:end])
+			records++
+		}
+	}
+	writeRecord("S5", records, nil)
+	writeRecord("S9", asm.startAddr, nil)
+
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestOutputFormats(t *testing.T) {
+	defer resetSymbols()
+
+	asm := assembleTestFile(t, "../examples/007_loader.asm")
+
+	tests := []struct {
+		format string
+		output string
+	}{{
+		"ihex",
+		":0E0801000D08D9079E20343931353200000031\n" +
+			":03C000004C00C130\n" +
+			":06C100002044E54C00C2E2\n" +
+			":06C20000A9582016E760BA\n" +
+			":00000001FF\n",
+	}, {
+		"srec",
+		"S009000078626261736D79\n" +
+			"S11108010D08D9079E2034393135320000002D\n" +
+			"S106C0004C00C12C\n" +
+			"S109C1002044E54C00C2DE\n" +
+			"S109C200A9582016E760B6\n" +
+			"S5030004F8\n" +
+			"S9030801F3\n",
+	}}
+
+	for _, test := range tests {
+		out, err := outputFormats[test.format](asm, outputOptions{})
+		if err != nil {
+			t.Errorf("%s: %s", test.format, err.Error())
+		} else if string(out) != test.output {
+			t.Errorf("%s: expected\n%s\nbut got\n%s", test.format, test.output, strings.TrimSpace(string(out)))
+		}
+	}
+
+	raw, _ := formatRaw(asm, outputOptions{})
+	if len(raw) != len(asm.program)-2 || raw[0] != 0x0d {
+		t.Errorf("raw: unexpected output starting with %x", raw[:2])
+	}
+}
+
+func TestCRTBanks(t *testing.T) {
+	defer resetSymbols()
+
+	asm, err := assembleLines(t, []string{".org $8000", "dfb 1,2", ".bank 1", ".org $8000", "dfb 3", ".org $e000", "dfb 4"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if _, err := formatPRG(asm, outputOptions{}); err == nil {
+		t.Errorf("prg: expected an error for a program with banks")
+	}
+
+	crt, err := formatCRT(asm, outputOptions{crtType: "easyflash", crtName: "banks"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// header plus three 8K chips
+	if len(crt) != crtHeaderLen+3*(crtChipHeader+crtWindowSize) {
+		t.Fatalf("crt: unexpected size %d", len(crt))
+	}
+
+	// signature, header length, version 1.0, hardware type 32,
+	// EXROM and GAME lines for Ultimax mode and the name
+	header := append([]byte("C64 CARTRIDGE   "), 0, 0, 0, 0x40, 1, 0, 0, 32, 1, 0, 0, 0, 0, 0, 0, 0)
+	header = append(header, "BANKS"...)
+	if !bytes.Equal(crt[:len(header)], header) {
+		t.Errorf("crt: expected the header\n% x\nbut got\n% x", header, crt[:len(header)])
+	}
+
+	tests := []struct {
+		bank  int
+		load  int
+		first byte
+	}{{
+		0, 0x8000, 1,
+	}, {
+		1, 0x8000, 3,
+	}, {
+		1, 0xA000, 4,
+	}}
+
+	for i, test := range tests {
+		chip := crt[crtHeaderLen+i*(crtChipHeader+crtWindowSize):]
+
+		// packet length, flash chip, bank, load address and size
+		expected := append([]byte("CHIP"), 0, 0, 0x20, 0x10, 0, crtChipFlash,
+			byte(test.bank>>8), byte(test.bank), byte(test.load>>8), byte(test.load), 0x20, 0)
+		if !bytes.Equal(chip[:crtChipHeader], expected) || chip[crtChipHeader] != test.first {
+			t.Errorf("chip %d: expected\n% x %02x\nbut got\n% x %02x", i, expected, test.first, chip[:crtChipHeader], chip[crtChipHeader])
+		}
+	}
+}
+
+func TestCRTTypes(t *testing.T) {
+	defer resetSymbols()
+
+	asm, err := assembleLines(t, []string{".org $8000", "dfb 1"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	tests := []struct {
+		crtType     string
+		hwType      byte
+		exrom, game byte
+		chip        byte
+		size        int
+	}{
+		{"normal8k", 0, 0, 1, crtChipROM, 0x2000},
+		{"normal16k", 0, 0, 0, crtChipROM, 0x4000},
+		{"ultimax", 0, 1, 0, crtChipROM, 0x2000},
+		{"ocean", 5, 0, 0, crtChipROM, 0x2000},
+		{"easyflash", 32, 1, 0, crtChipFlash, 0x2000},
+	}
+
+	for _, test := range tests {
+		crt, err := formatCRT(asm, outputOptions{crtType: test.crtType})
+		if err != nil {
+			t.Errorf("%s: %s", test.crtType, err.Error())
+			continue
+		} else if len(crt) != crtHeaderLen+crtChipHeader+test.size {
+			t.Errorf("%s: unexpected size %d", test.crtType, len(crt))
+			continue
+		}
+		if crt[0x17] != test.hwType || crt[0x18] != test.exrom || crt[0x19] != test.game {
+			t.Errorf("%s: expected type %d, EXROM %d and GAME %d but got % x", test.crtType, test.hwType, test.exrom, test.game, crt[0x16:0x1A])
+		}
+		chip := crt[crtHeaderLen:]
+		if string(chip[:4]) != "CHIP" || chip[9] != test.chip || int(chip[14])<<8|int(chip[15]) != test.size || chip[crtChipHeader] != 1 {
+			t.Errorf("%s: unexpected chip packet % x", test.crtType, chip[:crtChipHeader+1])
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"image/color"
+)
+
+// c64Palette has the 16 colors as measured by Pepto
+// for VICE, the ones most emulators show by default
+var c64Palette = [16]color.RGBA{
+	{0x00, 0x00, 0x00, 0xFF}, // black
+	{0xFF, 0xFF, 0xFF, 0xFF}, // white
+	{0x68, 0x37, 0x2B, 0xFF}, // red
+	{0x70, 0xA4, 0xB2, 0xFF}, // cyan
+	{0x6F, 0x3D, 0x86, 0xFF}, // purple
+	{0x58, 0x8D, 0x43, 0xFF}, // green
+	{0x35, 0x28, 0x79, 0xFF}, // blue
+	{0xB8, 0xC7, 0x6F, 0xFF}, // yellow
+	{0x6F, 0x4F, 0x25, 0xFF}, // orange
+	{0x43, 0x39, 0x00, 0xFF}, // brown
+	{0x9A, 0x67, 0x59, 0xFF}, // light red
+	{0x44, 0x44, 0x44, 0xFF}, // dark gray
+	{0x6C, 0x6C, 0x6C, 0xFF}, // gray
+	{0x9A, 0xD2, 0x84, 0xFF}, // light green
+	{0x6C, 0x5E, 0xB5, 0xFF}, // light blue
+	{0x95, 0x95, 0x95, 0xFF}, // light gray
+}
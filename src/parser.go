@@ -8,6 +8,15 @@ import (
 	"strings"
 )
 
+// sourceLocation points back to where a line of code
+// was read from, columns are 1-based and inclusive
+type sourceLocation struct {
+	file string
+	line int
+	col1 int
+	col2 int
+}
+
 type parser struct {
 	input     []string
 	output    []tokenizedLine
@@ -15,6 +24,7 @@ type parser struct {
 	fatal     error
 	currFPath string
 	tk        tokenizer
+	art       *artBlock // open .sprite or .char block
 }
 
 func beginParser(mainInput string) *parser {
@@ -56,21 +66,42 @@ func (p *parser) parse() {
 			rawline = fsc.Text()
 
 			// discard comments and trim spaces
-			cl := strings.TrimSpace(strings.Split(rawline, ";")[0])
+			code, lexErr := stripComment(rawline)
+			if lexErr == nil {
+				lexErr = checkEscapes(code)
+			}
+			if lexErr != nil {
+				p.errors = append(p.errors, fmt.Errorf("%s:%d:%s", *input, lnum, lexErr.Error()))
+				continue
+			}
+			cl := strings.TrimSpace(code)
 			if len(cl) == 0 {
 				continue
 			}
 
+			// keep the columns where the code starts and ends
+			// so debuggers can highlight the source statement
+			col := strings.Index(rawline, cl) + 1
+			loc := sourceLocation{file: *input, line: lnum, col1: col, col2: col + len(cl) - 1}
+
 			// parse line
-			if strings.HasPrefix(strings.ToLower(cl), "./include ") {
+			if p.art != nil {
+				p.parseArtRow(cl, loc)
+			} else if strings.HasPrefix(strings.ToLower(cl), "./include ") {
 				p.parseIncludeLine(cl, *input, lnum)
 			} else {
 				cl = fmt.Sprintf("%s%s", partial, cl)
-				partial = p.parseCodeLine(cl, *input, lnum)
+				partial = p.parseCodeLine(cl, loc)
 			}
 		}
 
 		file.Close()
+
+		if p.art != nil {
+			p.errors = append(p.errors, fmt.Errorf("%s:%d:Missing .end for %s block", p.art.line.loc.file,
+				p.art.line.loc.line, strings.ToLower(p.art.line.opc.mnemonic)))
+			p.art = nil
+		}
 	}
 
 	p.parse()
@@ -91,18 +122,40 @@ func (p *parser) parseIncludeLine(l, f string, lnum int) {
 	return
 }
 
-func (p *parser) parseCodeLine(l, f string, lnum int) string {
+func (p *parser) parseCodeLine(l string, loc sourceLocation) string {
 	if tl, err := p.tk.tokenize(l); err != nil {
-		p.errors = append(p.errors, fmt.Errorf("%s:%d:%s", f, lnum, err.Error()))
+		p.errors = append(p.errors, fmt.Errorf("%s:%d:%s", loc.file, loc.line, err.Error()))
 	} else if tl != nil {
 		if tl.label != "" && tl.opc.mnemonic == "" {
 			return tl.label + " "
 		}
+		tl.loc = loc
+		if isArtBlock(tl.opc.mnemonic) {
+			p.art = &artBlock{line: *tl}
+			return ""
+		}
 		p.outputPush(*tl)
 	}
 	return ""
 }
 
+// parseArtRow keeps a row of the open .sprite or .char
+// block, packing them all into bytes when it ends
+func (p *parser) parseArtRow(l string, loc sourceLocation) {
+	if !isArtBlockEnd(l) {
+		p.art.rows = append(p.art.rows, l)
+		p.art.locs = append(p.art.locs, loc)
+		return
+	}
+
+	if tl, err := p.art.pack(loc); err != nil {
+		p.errors = append(p.errors, err)
+	} else {
+		p.outputPush(*tl)
+	}
+	p.art = nil
+}
+
 func (p *parser) inputPush(i string) {
 	p.input = append(p.input, i)
 }
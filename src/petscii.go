@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Control codes can be written in text between braces with the names
+// used in listings and by petcat, like `{clr}`, `{rvs on}` or `{red}`,
+// repeated with a count before the name (`{3 down}`) or by their
+// value in hex as `{$93}`.
+
+var petsciiControlCodes = map[string]byte{
+	"stop":        0x03,
+	"wht":         0x05,
+	"white":       0x05,
+	"dish":        0x08,
+	"ensh":        0x09,
+	"return":      0x0D,
+	"swlc":        0x0E,
+	"lower":       0x0E,
+	"down":        0x11,
+	"rvs on":      0x12,
+	"rvson":       0x12,
+	"home":        0x13,
+	"del":         0x14,
+	"red":         0x1C,
+	"rght":        0x1D,
+	"right":       0x1D,
+	"grn":         0x1E,
+	"green":       0x1E,
+	"blu":         0x1F,
+	"blue":        0x1F,
+	"orng":        0x81,
+	"orange":      0x81,
+	"f1":          0x85,
+	"f3":          0x86,
+	"f5":          0x87,
+	"f7":          0x88,
+	"f2":          0x89,
+	"f4":          0x8A,
+	"f6":          0x8B,
+	"f8":          0x8C,
+	"swuc":        0x8E,
+	"upper":       0x8E,
+	"blk":         0x90,
+	"black":       0x90,
+	"up":          0x91,
+	"rvs off":     0x92,
+	"rvsoff":      0x92,
+	"clr":         0x93,
+	"clear":       0x93,
+	"inst":        0x94,
+	"brn":         0x95,
+	"brown":       0x95,
+	"lred":        0x96,
+	"pink":        0x96,
+	"gry1":        0x97,
+	"dark gray":   0x97,
+	"gry2":        0x98,
+	"gray":        0x98,
+	"lgrn":        0x99,
+	"light green": 0x99,
+	"lblu":        0x9A,
+	"light blue":  0x9A,
+	"gry3":        0x9B,
+	"light gray":  0x9B,
+	"pur":         0x9C,
+	"purple":      0x9C,
+	"left":        0x9D,
+	"yel":         0x9E,
+	"yellow":      0x9E,
+	"cyn":         0x9F,
+	"cyan":        0x9F,
+}
+
+// readPetsciiEscape reads the codes
+// for the text inside a pair of braces
+func readPetsciiEscape(e string) ([]byte, error) {
+
+	name := strings.ToLower(strings.TrimSpace(e))
+	count := 1
+
+	// repeat count
+	if fields := strings.SplitN(name, " ", 2); len(fields) == 2 {
+		if n, nErr := strconv.Atoi(fields[0]); nErr == nil {
+			if n < 1 {
+				return nil, fmt.Errorf("Invalid count in control code {%s}", e)
+			}
+			count = n
+			name = strings.TrimSpace(fields[1])
+		}
+	}
+
+	var code byte
+	if strings.HasPrefix(name, "$") {
+		v, vErr := strconv.ParseUint(name[1:], 16, 8)
+		if vErr != nil {
+			return nil, fmt.Errorf("Invalid control code {%s}", e)
+		}
+		code = byte(v)
+	} else if c, found := petsciiControlCodes[name]; found {
+		code = c
+	} else {
+		return nil, fmt.Errorf("Unknown control code {%s}", e)
+	}
+
+	codes := []byte{}
+	for i := 0; i < count; i++ {
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// asciiToPetscii converts a character with the petcat conventions:
+// lower case letters are the unshifted ones (upper case in the
+// default character set) and upper case letters are shifted
+func asciiToPetscii(c byte) (byte, error) {
+	switch {
+	case c >= 'a' && c <= 'z':
+		return c - 'a' + 0x41, nil
+	case c >= 'A' && c <= 'Z':
+		return c - 'A' + 0xC1, nil
+	case c == '\\':
+		return 0x5C, nil // pound sign
+	case c == '^':
+		return 0x5E, nil // up arrow
+	case c == '_':
+		return 0x5F, nil // left arrow
+	case c >= 0x20 && c <= 0x5D:
+		return c, nil
+	}
+	return 0, fmt.Errorf("Character %q has no PETSCII equivalent", c)
+}
+
+// The graphic characters written with their Unicode equivalents, as
+// shown with the upper case and graphics character set. The shifted
+// ones take the codes from $c0, like the upper case letters do.
+var unicodePetscii = map[rune]byte{
+	'£': 0x5C,
+	'↑': 0x5E,
+	'←': 0x5F,
+
+	// box drawing and lines
+	'─': 0xC0,
+	'│': 0xDD,
+	'┼': 0xDB,
+	'╭': 0xD5,
+	'╮': 0xC9,
+	'╰': 0xCA,
+	'╯': 0xCB,
+	'╲': 0xCD,
+	'╱': 0xCE,
+	'╳': 0xD6,
+	'├': 0xAB,
+	'┤': 0xB3,
+	'┬': 0xB2,
+	'┴': 0xB1,
+	'┌': 0xB0,
+	'┐': 0xAE,
+	'└': 0xAD,
+	'┘': 0xBD,
+
+	// lines off the center, from the Symbols for Legacy Computing
+	'\U0001FB70': 0xD4,
+	'\U0001FB71': 0xC7,
+	'\U0001FB72': 0xC2,
+	'\U0001FB74': 0xC8,
+	'\U0001FB75': 0xD9,
+	'\U0001FB76': 0xC5,
+	'\U0001FB77': 0xC4,
+	'\U0001FB78': 0xC3,
+	'\U0001FB7A': 0xC6,
+	'\U0001FB7B': 0xD2,
+	'\U0001FB7C': 0xCC,
+	'\U0001FB7D': 0xCF,
+	'\U0001FB7E': 0xD0,
+	'\U0001FB7F': 0xBA,
+	'\U0001FB82': 0xB7,
+	'\U0001FB83': 0xB8,
+	'\U0001FB87': 0xAA,
+	'\U0001FB88': 0xB6,
+	'\U0001FB8C': 0xDC,
+	'\U0001FB8F': 0xA8,
+
+	// card suits and shapes
+	'♠': 0xC1,
+	'♥': 0xD3,
+	'♣': 0xD8,
+	'♦': 0xDA,
+	'●': 0xD1,
+	'○': 0xD7,
+	'π': 0xDE,
+	'◤': 0xA9,
+	'◥': 0xDF,
+
+	// block elements
+	'▌': 0xA1,
+	'▄': 0xA2,
+	'▔': 0xA3,
+	'▁': 0xA4,
+	'▏': 0xA5,
+	'▒': 0xA6,
+	'▕': 0xA7,
+	'▗': 0xAC,
+	'▂': 0xAF,
+	'▎': 0xB4,
+	'▍': 0xB5,
+	'▃': 0xB9,
+	'▖': 0xBB,
+	'▝': 0xBC,
+	'▘': 0xBE,
+	'▚': 0xBF,
+}
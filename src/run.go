@@ -0,0 +1,339 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	defaultCycleLimit = 1000000
+	rtsCycles         = 6
+)
+
+// runRoutine calls the routine at the start address as a JSR would
+// and runs it until it returns, hits a BRK or takes more cycles than
+// the limit. Each instruction is written to the trace if not nil.
+// With the raster simulated its interrupts are taken between the
+// instructions. It returns a description of where it stopped.
+func runRoutine(c *cpu, start, limit int, trace *tracer) (string, error) {
+
+	c.pc = start
+	sp := c.sp
+
+	for {
+		if c.vic != nil {
+			c.vic.advance(c.cycles)
+			if c.vic.irq() && !c.flag(flagI) {
+				if trace != nil {
+					trace.interrupt(c)
+				}
+				c.interrupt()
+				if trace != nil {
+					trace.registers(c)
+				}
+			}
+		}
+
+		// the stand-ins return as their RTS would
+		if h, found := c.hooks[c.pc]; found {
+			pc := c.pc
+			if trace != nil {
+				trace.hook(c, h)
+			}
+			h.run(c)
+			c.cycles += rtsCycles
+			if c.pc != pc {
+				if trace != nil {
+					trace.registers(c)
+				}
+				continue
+			}
+			if c.sp == sp {
+				if trace != nil {
+					trace.registers(c)
+				}
+				return fmt.Sprintf("rts of %s at $%04x", h.name, pc), nil
+			}
+			c.rts()
+			if trace != nil {
+				trace.registers(c)
+			}
+			continue
+		}
+
+		opc, _, err := c.fetch()
+		if err != nil {
+			return "", err
+		}
+		pc := c.pc
+
+		if trace != nil {
+			trace.instruction(c)
+		}
+
+		// the RTS of the routine itself is not run since
+		// there's nowhere to return, only its cycles count
+		if opc.mnemonic == "RTS" && c.sp == sp {
+			c.cycles += opc.cycles
+			if trace != nil {
+				trace.registers(c)
+			}
+			return fmt.Sprintf("rts at $%04x", pc), nil
+		} else if opc.mnemonic == "BRK" {
+			if trace != nil {
+				trace.registers(c)
+			}
+			return fmt.Sprintf("brk at $%04x", pc), nil
+		}
+
+		if err := c.step(); err != nil {
+			return "", err
+		}
+		if trace != nil {
+			trace.registers(c)
+		}
+
+		if c.cycles > limit {
+			return "", &cycleLimitError{limit: limit, pc: c.pc}
+		}
+	}
+}
+
+// cycleLimitError is returned when a routine doesn't return in time,
+// which is expected when running a whole program looping forever
+type cycleLimitError struct {
+	limit, pc int
+}
+
+func (e *cycleLimitError) Error() string {
+	return fmt.Sprintf("Cycle limit of %d reached at $%04x", e.limit, e.pc)
+}
+
+// tracer writes each instruction run with the
+// registers and the cycles taken after it
+type tracer struct {
+	out   io.Writer
+	names map[int]string
+	d     *disassembler
+}
+
+func newTracer(out io.Writer) *tracer {
+
+	// the first name in order for each address
+	names := map[int]string{}
+	for _, sym := range sortedSymbols() {
+		if _, found := names[symbols[sym]]; !found {
+			names[symbols[sym]] = sym
+		}
+	}
+
+	return &tracer{out: out, names: names, d: &disassembler{names: names}}
+}
+
+func (t *tracer) instruction(c *cpu) {
+	opc, operand, _ := c.fetch()
+
+	if name, found := t.names[c.pc]; found {
+		fmt.Fprintf(t.out, "%s:\n", name)
+	}
+
+	hex := make([]string, opc.len)
+	for i := range hex {
+		hex[i] = fmt.Sprintf("%02x", c.read(c.pc+i))
+	}
+
+	text := strings.ToLower(opc.mnemonic)
+	if opr := t.d.operandText(disasmItem{addr: c.pc, opc: opc, operand: operand}); opr != "" {
+		text += " " + opr
+	}
+
+	fmt.Fprintf(t.out, "$%04x  %-8s  %-20s", c.pc, strings.Join(hex, " "), text)
+}
+
+// hook writes a routine done by a stand-in
+func (t *tracer) hook(c *cpu, h hook) {
+	if name, found := t.names[c.pc]; found {
+		fmt.Fprintf(t.out, "%s:\n", name)
+	}
+	fmt.Fprintf(t.out, "$%04x  %-8s  %-20s", c.pc, "kernal", h.name)
+}
+
+// interrupt writes where an IRQ was taken
+func (t *tracer) interrupt(c *cpu) {
+	fmt.Fprintf(t.out, "$%04x  %-8s  %-20s", c.pc, "irq", fmt.Sprintf("raster $%03x", c.vic.raster()))
+}
+
+func (t *tracer) registers(c *cpu) {
+	fmt.Fprintf(t.out, "%s  %d\n", registersText(c), c.cycles)
+}
+
+// registersText shows the registers and
+// the flags set in upper case
+func registersText(c *cpu) string {
+	flags := []byte("nv-bdizc")
+	for i := range flags {
+		if c.p&(0x80>>uint(i)) != 0 {
+			flags[i] -= 'a' - 'A'
+		}
+	}
+	flags[2] = '-'
+	return fmt.Sprintf("A=%02x X=%02x Y=%02x SP=%02x %s", c.a, c.x, c.y, c.sp, flags)
+}
+
+// setValue sets a register (a, x, y, sp), a flag
+// (c, z, i, d, v, n) or a memory address to a value
+func setValue(c *cpu, target string, value int) error {
+
+	flags := map[string]byte{"c": flagC, "z": flagZ, "i": flagI, "d": flagD, "v": flagV, "n": flagN}
+
+	if value < 0 || value > 0xFF {
+		return fmt.Errorf("Out of range value %d for %s", value, target)
+	}
+
+	switch t := strings.ToLower(target); {
+	case t == "a":
+		c.a = byte(value)
+	case t == "x":
+		c.x = byte(value)
+	case t == "y":
+		c.y = byte(value)
+	case t == "sp":
+		c.sp = byte(value)
+	case flags[t] != 0:
+		if value > 1 {
+			return fmt.Errorf("Flag %s can only be 0 or 1", target)
+		}
+		c.setFlag(flags[t], value == 1)
+	default:
+		addr, addrErr := resolveExpression(target)
+		if addrErr != nil {
+			return addrErr
+		} else if addr < 0 || addr > 0xFFFF {
+			return fmt.Errorf("Out of range address %s", target)
+		}
+		c.write(addr, byte(value))
+	}
+	return nil
+}
+
+// readSettings reads a list like `a=5,x=$10,$fc=7` for setValue
+func readSettings(c *cpu, list string) error {
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("Syntax error in %s, expecting {register, flag or address}={value}", s)
+		}
+		value, valErr := resolveExpression(strings.TrimSpace(kv[1]))
+		if valErr != nil {
+			return valErr
+		}
+		if err := setValue(c, strings.TrimSpace(kv[0]), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+// Command:
+// -----------------------------------------------------------------------------
+
+// runMain runs `xbbasm run [options] file.asm`
+func runMain(args []string) {
+
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	start := fs.String("start", "", "label or address to start at (default: lowest address of the program)")
+	limit := fs.Int("limit", defaultCycleLimit, "stop after running this many cycles")
+	set := fs.String("set", "", "registers, flags or memory to set before running, like `a=5,$fc=7`")
+	quiet := fs.Bool("quiet", false, "don't trace the instructions, only show the result")
+	useKernal := fs.Bool("kernal", false, "do the KERNAL screen routines in Go and show what was printed")
+	screenshot := fs.String("screenshot", "", "write the text screen at the end as a PNG `file`")
+	charsetAddr := fs.String("charset", "", "label or address of the character set for the screenshot (default: built-in font)")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fail("must specify input file")
+	}
+
+	asm := assembleFile(fs.Arg(0))
+	if asm.program == nil {
+		fail(errBanked.Error())
+	}
+
+	c := newCPU()
+	c.vic = &vic{}
+	var k *kernal
+	if *useKernal {
+		k = installKernal(c)
+	}
+	c.load(asm.program)
+
+	startAddr := asm.startAddr
+	if *start != "" {
+		var err error
+		if startAddr, err = resolveExpression(*start); err != nil {
+			fail(err.Error())
+		}
+	}
+	if err := readSettings(c, *set); err != nil {
+		fail(err.Error())
+	}
+
+	var trace *tracer
+	if !*quiet {
+		trace = newTracer(os.Stdout)
+	}
+
+	stop, err := runRoutine(c, startAddr, *limit, trace)
+	if limitErr, reached := err.(*cycleLimitError); reached {
+		stop = fmt.Sprintf("limit reached at $%04x", limitErr.pc)
+	} else if err != nil {
+		fail(err.Error())
+	}
+	fmt.Printf("%s after %d cycles: %s\n", stop, c.cycles, registersText(c))
+
+	if k != nil {
+		fmt.Printf("--- console:\n%s\n--- screen:\n%s\n", petsciiToText(k.console), screenText(c))
+	}
+
+	if *screenshot != "" {
+		charset := defaultCharset()
+		if *charsetAddr != "" {
+			addr, addrErr := resolveExpression(*charsetAddr)
+			if addrErr != nil {
+				fail(addrErr.Error())
+			}
+			charset = readCharset(c, addr)
+		}
+		if err := writeScreenshot(c, charset, *screenshot); err != nil {
+			fail(err.Error())
+		}
+	}
+}
+
+// assembleFile parses and assembles a program
+// for the subcommands, exits on any error
+func assembleFile(input string) *assembly {
+	p := beginParser(input)
+	if p.fatal != nil {
+		fail(p.fatal.Error())
+	} else if len(p.errors) > 0 {
+		for _, e := range p.errors {
+			fmt.Fprintln(os.Stderr, e.Error())
+		}
+		os.Exit(1)
+	}
+
+	asm, err := assemble(p.output)
+	if err != nil {
+		fail(err.Error())
+	}
+	printMessages(asm.messages)
+	return asm
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+)
+
+// Screenshots show the text screen as the VIC-II would in the default
+// setup: screen memory at $0400, color memory at $D800 and the border
+// and background colors at $D020 and $D021. The VIC-II bank and $D018
+// are not followed, a character set in the program is picked instead.
+// The screen is taken once at the end, so raster effects changing the
+// colors midway down show as the registers were left.
+
+const (
+	screenshotBorder = 32
+	charsetSize      = 0x800
+)
+
+// renderScreen draws the 40x25 text screen with a border around it,
+// with the characters from the 2K character set
+func renderScreen(c *cpu, charset []byte) *image.Paletted {
+
+	palette := color.Palette{}
+	for _, rgba := range c64Palette {
+		palette = append(palette, rgba)
+	}
+
+	width := screenCols*8 + 2*screenshotBorder
+	height := screenRows*8 + 2*screenshotBorder
+	img := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+
+	border := c.read(borderColor) & 0x0F
+	for i := range img.Pix {
+		img.Pix[i] = border
+	}
+
+	background := c.read(bgColor) & 0x0F
+	for row := 0; row < screenRows; row++ {
+		for col := 0; col < screenCols; col++ {
+			code := int(c.read(screenMem + row*screenCols + col))
+			fg := c.read(colorMem+row*screenCols+col) & 0x0F
+
+			for y := 0; y < 8; y++ {
+				bits := charset[code*8+y]
+				for x := 0; x < 8; x++ {
+					pixel := background
+					if bits&(0x80>>uint(x)) != 0 {
+						pixel = fg
+					}
+					img.SetColorIndex(screenshotBorder+col*8+x, screenshotBorder+row*8+y, pixel)
+				}
+			}
+		}
+	}
+	return img
+}
+
+// writeScreenshot saves the rendered screen as a PNG
+func writeScreenshot(c *cpu, charset []byte, filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, renderScreen(c, charset)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readCharset takes the 2K character set at an address of the memory
+func readCharset(c *cpu, addr int) []byte {
+	charset := make([]byte, charsetSize)
+	for i := range charset {
+		charset[i] = c.read(addr + i)
+	}
+	return charset
+}
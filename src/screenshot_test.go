@@ -0,0 +1,110 @@
+package main
+
+import (
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScreenshot(t *testing.T) {
+	c := newCPU()
+	k := installKernal(c)
+	for _, ch := range []byte{0x1C, 0x49, 0x12, 0x20} { // red I, reversed space
+		c.a = ch
+		k.chrout(c)
+	}
+
+	filename := filepath.Join(t.TempDir(), "screen.png")
+	if err := writeScreenshot(c, defaultCharset(), filename); err != nil {
+		t.Fatal(err.Error())
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if b := img.Bounds(); b.Dx() != 384 || b.Dy() != 264 {
+		t.Fatalf("expected a 384x264 screenshot but got %dx%d", b.Dx(), b.Dy())
+	}
+
+	var tests = []struct {
+		x, y  int
+		color int
+	}{
+		{0, 0, defaultBorderColor},
+		{screenshotBorder, screenshotBorder, defaultBgColor},         // left of the I
+		{screenshotBorder + 3, screenshotBorder, 2},                  // top of the I
+		{screenshotBorder + 3, screenshotBorder + 7, defaultBgColor}, // below the I
+		{screenshotBorder + 8, screenshotBorder, 2},                  // reversed space
+		{screenshotBorder + 16, screenshotBorder, defaultBgColor},
+	}
+	for _, test := range tests {
+		if actual := img.At(test.x, test.y); actual != c64Palette[test.color] {
+			t.Errorf("expected color %d at %d,%d but got %v", test.color, test.x, test.y, actual)
+		}
+	}
+}
+
+func TestReadCharset(t *testing.T) {
+	c := newCPU()
+	c.write(0x2000+8, 0xFF)
+	charset := readCharset(c, 0x2000)
+	if len(charset) != charsetSize || charset[8] != 0xFF || charset[0] != 0 {
+		t.Errorf("expected the character set read from $2000")
+	}
+
+	// the built-in one has the reversed characters in the upper half
+	charset = defaultCharset()
+	for i := 0; i < 0x400; i++ {
+		if charset[i] != ^charset[i+0x400] {
+			t.Fatalf("expected byte %d reversed at %d", i, i+0x400)
+		}
+	}
+}
+
+func TestScreenshotRasterInterrupt(t *testing.T) {
+	defer resetSymbols()
+
+	// the intro writes its text in black and colors it from a raster IRQ
+	asm := assembleTestFile(t, "../examples/dustlayer_ep2_intro/index.asm")
+	c := newCPU()
+	c.vic = &vic{}
+	installKernal(c)
+	c.load(asm.program)
+
+	if _, err := runRoutine(c, symbols["main"], defaultCycleLimit, nil); err == nil {
+		t.Fatalf("expected the intro looping until the limit")
+	}
+
+	img := renderScreen(c, defaultCharset())
+	for _, row := range []int{10, 12} {
+		lit := 0
+		for y := 0; y < 8; y++ {
+			for x := 0; x < screenCols*8; x++ {
+				if img.ColorIndexAt(screenshotBorder+x, screenshotBorder+row*8+y) != 0 {
+					lit++
+				}
+			}
+		}
+		if lit == 0 {
+			t.Errorf("expected the text on row %d colored but it's all black", row)
+		}
+	}
+}
+
+func TestDefaultFont(t *testing.T) {
+	// each screen code has its own glyph, only the two spaces are the same
+	glyphs := map[[8]byte]int{}
+	for code, glyph := range defaultFont {
+		if prev, found := glyphs[glyph]; found && !(prev == 0x20 && code == 0x60) {
+			t.Errorf("expected a glyph for $%02x different from $%02x", code, prev)
+		}
+		glyphs[glyph] = code
+	}
+}
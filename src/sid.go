@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// SID tunes in the PSID or RSID format of the High Voltage SID
+// Collection. The header is big endian, unlike the load address
+// at the beginning of the data when the header doesn't have it.
+//
+// `-format psid` writes the program as a PSID v2 file, so players
+// and data can be tried out in any SID player.
+//
+// `./sid music.sid` puts the music at its load address in its own
+// segment and defines the symbols `sid.init`, `sid.play`, `sid.songs`,
+// `sid.startsong`, `sid.load` and `sid.end` (the address after the
+// data), with another prefix than `sid` when given after the file.
+
+const (
+	sidHeaderV1Len = 0x76
+	sidHeaderV2Len = 0x7C
+	sidTextLen     = 32
+	sidMaxSongs    = 256
+	sidSpeedBits   = 32 // songs after the 32nd use the speed of the last
+	defaultSIDName = "sid"
+
+	sidFlagClockShift = 2
+	sidFlagModelShift = 4
+)
+
+// values for the clock and model in the flags of the header,
+// the same for both: 0 unknown, 1 PAL/6581, 2 NTSC/8580, 3 both
+var (
+	sidClocks = map[string]int{"unknown": 0, "pal": 1, "ntsc": 2, "any": 3}
+	sidModels = map[string]int{"unknown": 0, "6581": 1, "8580": 2, "any": 3}
+)
+
+type sidTune struct {
+	rsid      bool
+	version   int
+	load      int
+	init      int
+	play      int // 0 when the tune sets its own interrupt
+	songs     int
+	startSong int
+	speed     uint32
+	title     string
+	author    string
+	released  string
+	flags     int
+	data      []byte
+}
+
+// readSID parses a PSID or RSID file
+func readSID(filename string) (*sidTune, error) {
+
+	file, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(file) < sidHeaderV1Len {
+		return nil, fmt.Errorf("Too short for a SID file")
+	}
+
+	magic := string(file[0:4])
+	if magic != "PSID" && magic != "RSID" {
+		return nil, fmt.Errorf("Not a PSID or RSID file")
+	}
+
+	word := func(offset int) int {
+		return int(binary.BigEndian.Uint16(file[offset:]))
+	}
+	text := func(offset int) string {
+		return strings.TrimRight(string(file[offset:offset+sidTextLen]), "\x00")
+	}
+
+	s := &sidTune{
+		rsid:      magic == "RSID",
+		version:   word(0x04),
+		load:      word(0x08),
+		init:      word(0x0A),
+		play:      word(0x0C),
+		songs:     word(0x0E),
+		startSong: word(0x10),
+		speed:     binary.BigEndian.Uint32(file[0x12:]),
+		title:     text(0x16),
+		author:    text(0x36),
+		released:  text(0x56),
+	}
+
+	dataOffset := word(0x06)
+	if dataOffset < sidHeaderV1Len || dataOffset > len(file) {
+		return nil, fmt.Errorf("Invalid data offset $%04x", dataOffset)
+	}
+	if s.version >= 2 && dataOffset >= sidHeaderV2Len {
+		s.flags = word(0x76)
+	}
+	s.data = file[dataOffset:]
+
+	// the load address can come with the data like in a PRG
+	if s.load == 0 {
+		if len(s.data) < 2 {
+			return nil, fmt.Errorf("No load address found")
+		}
+		s.load = int(s.data[0]) | int(s.data[1])<<8
+		s.data = s.data[2:]
+	} else if s.rsid {
+		return nil, fmt.Errorf("RSID files must have the load address with the data")
+	}
+	if len(s.data) == 0 {
+		return nil, fmt.Errorf("No music data found")
+	} else if s.load+len(s.data) > 0x10000 {
+		return nil, fmt.Errorf("Music at $%04x doesn't fit in memory", s.load)
+	}
+
+	if s.init == 0 {
+		s.init = s.load
+	}
+	if s.songs < 1 || s.songs > sidMaxSongs {
+		return nil, fmt.Errorf("Invalid number of songs %d", s.songs)
+	}
+	if s.startSong == 0 {
+		s.startSong = 1
+	}
+	return s, nil
+}
+
+// saveSymbols defines the addresses and numbers of the tune
+func (s *sidTune) saveSymbols(prefix string) error {
+	values := []struct {
+		name  string
+		value int
+	}{
+		{"init", s.init},
+		{"play", s.play},
+		{"songs", s.songs},
+		{"startsong", s.startSong},
+		{"load", s.load},
+		{"end", s.load + len(s.data)},
+	}
+	for _, v := range values {
+		if err := saveSymbol(prefix+"."+v.name, v.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// segment puts the data at the load address
+func (s *sidTune) segment(bank int, loc sourceLocation) segment {
+	addr := s.load
+	return segment{partiallyAssembled: binInclude(s.data, &addr, loc), bank: bank}
+}
+
+// file writes the tune as a PSID v2 file
+// with the load address before the data
+func (s *sidTune) file() []byte {
+	header := make([]byte, sidHeaderV2Len)
+	copy(header, "PSID")
+	for offset, v := range map[int]int{
+		0x04: 2,
+		0x06: sidHeaderV2Len,
+		0x08: 0,
+		0x0A: s.init,
+		0x0C: s.play,
+		0x0E: s.songs,
+		0x10: s.startSong,
+		0x76: s.flags,
+	} {
+		binary.BigEndian.PutUint16(header[offset:], uint16(v))
+	}
+	binary.BigEndian.PutUint32(header[0x12:], s.speed)
+	copy(header[0x16:0x16+sidTextLen], s.title)
+	copy(header[0x36:0x36+sidTextLen], s.author)
+	copy(header[0x56:0x56+sidTextLen], s.released)
+
+	return append(append(header, byte(s.load), byte(s.load>>8)), s.data...)
+}
+
+// formatPSID wraps the program in a PSID header, taking the init
+// and play routines from the symbols or addresses in the options
+func formatPSID(asm *assembly, opts outputOptions) ([]byte, error) {
+	if asm.program == nil {
+		return nil, errBanked
+	}
+
+	s := &sidTune{
+		load:      asm.startAddr,
+		songs:     opts.sidSongs,
+		startSong: opts.sidStartSong,
+		title:     opts.sidTitle,
+		author:    opts.sidAuthor,
+		released:  opts.sidReleased,
+		data:      asm.program[2:],
+	}
+
+	var err error
+	if s.init, err = resolveExpression(opts.sidInit); err != nil {
+		return nil, fmt.Errorf("Init routine: %s", err.Error())
+	} else if s.play, err = resolveExpression(opts.sidPlay); err != nil {
+		return nil, fmt.Errorf("Play routine: %s", err.Error())
+	}
+
+	if s.songs < 1 || s.songs > sidMaxSongs {
+		return nil, fmt.Errorf("Invalid number of songs %d", s.songs)
+	} else if s.startSong < 1 || s.startSong > s.songs {
+		return nil, fmt.Errorf("Invalid start song %d of %d", s.startSong, s.songs)
+	}
+
+	for _, text := range []string{s.title, s.author, s.released} {
+		if len(text) > sidTextLen {
+			return nil, fmt.Errorf("%q is longer than %d characters", text, sidTextLen)
+		} else if !isAsciiString(text) {
+			return nil, fmt.Errorf("%q is not a valid ASCII text", text)
+		}
+	}
+
+	switch opts.sidSpeed {
+	case "vbi":
+	case "cia":
+		s.speed = 1<<sidSpeedBits - 1
+	default:
+		return nil, fmt.Errorf("Unknown speed %s, expecting vbi or cia", opts.sidSpeed)
+	}
+
+	clock, clockFound := sidClocks[opts.sidClock]
+	model, modelFound := sidModels[opts.sidModel]
+	if !clockFound {
+		return nil, fmt.Errorf("Unknown clock %s, expecting pal, ntsc, any or unknown", opts.sidClock)
+	} else if !modelFound {
+		return nil, fmt.Errorf("Unknown SID model %s, expecting 6581, 8580, any or unknown", opts.sidModel)
+	}
+	s.flags = clock<<sidFlagClockShift | model<<sidFlagModelShift
+
+	return s.file(), nil
+}
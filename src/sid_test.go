@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sidFile builds a PSID v2 file with the load address in the header
+func sidFile(load, init, play, songs int, data []byte) []byte {
+	header := make([]byte, sidHeaderV2Len)
+	copy(header, "PSID")
+	for i, v := range []int{2, sidHeaderV2Len, load, init, play, songs, 1} {
+		binary.BigEndian.PutUint16(header[4+i*2:], uint16(v))
+	}
+	copy(header[0x16:], "Title")
+	copy(header[0x36:], "Author")
+	return append(header, data...)
+}
+
+func TestReadSID(t *testing.T) {
+	dir := t.TempDir()
+
+	// HVSC files leave the load address in the header at 0
+	// and put it in front of the data instead
+	music := []byte{0x4C, 0x7A, 0x10, 0x4C, 0xAA, 0x10}
+	for i, file := range [][]byte{
+		sidFile(0x1000, 0x1000, 0x1006, 1, music),
+		sidFile(0, 0x1000, 0x1006, 1, append([]byte{0x00, 0x10}, music...)),
+		bytes.Replace(sidFile(0, 0, 0x1006, 1, append([]byte{0x00, 0x10}, music...)), []byte("PSID"), []byte("RSID"), 1),
+	} {
+		filename := filepath.Join(dir, "tune.sid")
+		if err := ioutil.WriteFile(filename, file, 0644); err != nil {
+			t.Fatal(err.Error())
+		}
+		s, err := readSID(filename)
+		if err != nil {
+			t.Errorf("test %d: unexpected error %s", i, err.Error())
+			continue
+		}
+		if s.load != 0x1000 || s.init != 0x1000 || s.play != 0x1006 || s.songs != 1 || s.startSong != 1 {
+			t.Errorf("test %d: unexpected addresses load $%04x init $%04x play $%04x songs %d", i, s.load, s.init, s.play, s.songs)
+		}
+		if s.title != "Title" || s.author != "Author" || !bytes.Equal(s.data, music) {
+			t.Errorf("test %d: unexpected %q by %q with % x", i, s.title, s.author, s.data)
+		}
+	}
+
+	var tests = []struct {
+		file []byte
+		err  string
+	}{
+		{[]byte("PSID"), "Too short for a SID file"},
+		{bytes.Replace(sidFile(0x1000, 0, 0, 1, []byte{1}), []byte("PSID"), []byte("MUS "), 1), "Not a PSID or RSID file"},
+		{bytes.Replace(sidFile(0x1000, 0, 0, 1, []byte{1}), []byte("PSID"), []byte("RSID"), 1), "RSID files must have the load address with the data"},
+		{sidFile(0, 0, 0, 1, []byte{1}), "No load address found"},
+		{sidFile(0x1000, 0, 0, 1, nil), "No music data found"},
+		{sidFile(0xFFFF, 0, 0, 1, []byte{1, 2}), "Music at $ffff doesn't fit in memory"},
+		{sidFile(0x1000, 0, 0, 0, []byte{1}), "Invalid number of songs 0"},
+	}
+	for i, test := range tests {
+		filename := filepath.Join(dir, "bad.sid")
+		if err := ioutil.WriteFile(filename, test.file, 0644); err != nil {
+			t.Fatal(err.Error())
+		}
+		if _, err := readSID(filename); err == nil || err.Error() != test.err {
+			t.Errorf("test %d: expected error %s but got %v", i, test.err, err)
+		}
+	}
+}
+
+func TestSIDInclude(t *testing.T) {
+	defer resetSymbols()
+
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "music.sid"), sidFile(0x1000, 0, 0x1003, 3, []byte{0x60, 0, 0, 0x60}), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	source := strings.Join([]string{
+		".org $1008",
+		"\tjsr tune.init",
+		"./sid music.sid tune",
+		"\tjmp tune.play",
+	}, "\n")
+	filename := filepath.Join(dir, "sid.asm")
+	if err := ioutil.WriteFile(filename, []byte(source), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	asm := assembleTestFile(t, filename)
+	expected := []byte{0x00, 0x10, 0x60, 0, 0, 0x60, 0, 0, 0, 0, 0x20, 0x00, 0x10, 0x4C, 0x03, 0x10}
+	if !bytes.Equal(asm.program, expected) {
+		t.Errorf("expected % x but got % x", expected, asm.program)
+	}
+	for name, value := range map[string]int{"tune.init": 0x1000, "tune.play": 0x1003, "tune.songs": 3, "tune.startsong": 1, "tune.load": 0x1000, "tune.end": 0x1004} {
+		if symbols[name] != value {
+			t.Errorf("expected %s = $%04x but got $%04x", name, value, symbols[name])
+		}
+	}
+	if len(asm.tunes) != 1 || asm.tunes[0].title != "Title" {
+		t.Errorf("expected the tune kept in the assembly")
+	}
+}
+
+func TestFormatPSID(t *testing.T) {
+	defer resetSymbols()
+
+	dir := t.TempDir()
+	source := strings.Join([]string{
+		".org $1000",
+		"init\tlda #0",
+		"\tsta $d418",
+		"\trts",
+		"play\tinc $d020",
+		"\trts",
+	}, "\n")
+	filename := filepath.Join(dir, "player.asm")
+	if err := ioutil.WriteFile(filename, []byte(source), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	asm := assembleTestFile(t, filename)
+
+	opts := outputOptions{
+		sidInit: "init", sidPlay: "play", sidSongs: 2, sidStartSong: 2,
+		sidTitle: "Test", sidAuthor: "Someone", sidReleased: "2026 Group",
+		sidSpeed: "cia", sidClock: "pal", sidModel: "8580",
+	}
+	out, err := formatPSID(asm, opts)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	sidname := filepath.Join(dir, "player.sid")
+	if err := ioutil.WriteFile(sidname, out, 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	s, err := readSID(sidname)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.load != 0x1000 || s.init != 0x1000 || s.play != 0x1006 || s.songs != 2 || s.startSong != 2 {
+		t.Errorf("unexpected addresses load $%04x init $%04x play $%04x songs %d", s.load, s.init, s.play, s.songs)
+	}
+	if s.title != "Test" || s.author != "Someone" || s.released != "2026 Group" {
+		t.Errorf("unexpected texts %q %q %q", s.title, s.author, s.released)
+	}
+	if s.speed != 0xFFFFFFFF || s.flags != 0x24 || !bytes.Equal(s.data, asm.program[2:]) {
+		t.Errorf("unexpected speed %x, flags %x or data % x", s.speed, s.flags, s.data)
+	}
+
+	var tests = []struct {
+		change func(o *outputOptions)
+		err    string
+	}{
+		{func(o *outputOptions) { o.sidPlay = "missing" }, "Play routine: Undefined symbol missing"},
+		{func(o *outputOptions) { o.sidStartSong = 3 }, "Invalid start song 3 of 2"},
+		{func(o *outputOptions) { o.sidSongs = 0 }, "Invalid number of songs 0"},
+		{func(o *outputOptions) { o.sidTitle = strings.Repeat("x", 33) }, `"` + strings.Repeat("x", 33) + `" is longer than 32 characters`},
+		{func(o *outputOptions) { o.sidSpeed = "fast" }, "Unknown speed fast, expecting vbi or cia"},
+		{func(o *outputOptions) { o.sidModel = "6582" }, "Unknown SID model 6582, expecting 6581, 8580, any or unknown"},
+	}
+	for i, test := range tests {
+		o := opts
+		test.change(&o)
+		if _, err := formatPSID(asm, o); err == nil || err.Error() != test.err {
+			t.Errorf("test %d: expected error %s but got %v", i, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Sprites from PNG images with `./sprite {file.png} [multicolor]
+// [colors={c},{c}...]`. The image is a sheet of 24x21 pixel sprites,
+// read left to right and top to bottom, and each one is written as 63
+// bytes plus a padding byte, so they fill the 64 bytes blocks that
+// sprite pointers point to.
+//
+// Pixels take the closest color of the C64 palette and the colors
+// list gives the index of the color for each value of the bits, in
+// order: 0 and 1 for hires, 00, 01, 10 and 11 for multicolor (that
+// is background, multicolor 1, sprite color and multicolor 2).
+// Multicolor sprites are drawn with double wide pixels, only the left
+// one of each pair is read. Transparent pixels are always background.
+//
+// Without the colors list, hires sprites have black as background and
+// any other color set, and multicolor ones black as background and
+// the others in the order of the palette.
+//
+// The label of the line (or else the file name) names the first
+// sprite, `{name}.ptr` is its sprite pointer (the next ones follow)
+// and `{name}.count` the number of sprites in the sheet.
+
+const (
+	spriteWidth  = 24
+	spriteHeight = 21
+	spriteBytes  = 63
+	spriteBlock  = 64
+	vicBankSize  = 0x4000
+)
+
+// readSprites reads the sprites of a sheet into 64 bytes blocks
+func readSprites(filename string, multicolor bool, colors []int) ([]byte, int, error) {
+
+	img, err := readPNG(filename)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	bounds := img.Bounds()
+	if bounds.Dx()%spriteWidth != 0 || bounds.Dy()%spriteHeight != 0 {
+		return nil, 0, fmt.Errorf("Image of %dx%d pixels is not a sheet of 24x21 sprites", bounds.Dx(), bounds.Dy())
+	}
+
+	values, err := colorValues(img, multicolor, colors)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	data := []byte{}
+	count := 0
+	for sy := bounds.Min.Y; sy < bounds.Max.Y; sy += spriteHeight {
+		for sx := bounds.Min.X; sx < bounds.Max.X; sx += spriteWidth {
+			rows, rowsErr := readRows(img, sx, sy, spriteWidth, spriteHeight, bitsPerPixel(multicolor), values)
+			if rowsErr != nil {
+				return nil, 0, rowsErr
+			}
+			data = append(data, rows...)
+			data = append(data, make([]byte, spriteBlock-spriteBytes)...)
+			count++
+		}
+	}
+	return data, count, nil
+}
+
+// spritePointer is the value for the sprite pointers
+// of the block at the address, in its VIC-II bank
+func spritePointer(addr int) int {
+	return addr % vicBankSize / spriteBlock
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadSprites(t *testing.T) {
+	dir := t.TempDir()
+	sheet := filepath.Join(dir, "sheet.png")
+	// two sprites side by side
+	writeImage(t, sheet, 2*spriteWidth, spriteHeight, map[[2]int]int{
+		{0, 0}: 1, {23, 0}: 7, {8, 20}: 1,
+		{24, 0}: 2, {26, 0}: 5, {28, 0}: 6, {30, 0}: 0,
+	})
+
+	var tests = []struct {
+		multicolor bool
+		colors     []int
+		expected   map[int]byte // offset in the data
+		err        string
+	}{
+		{false, nil, map[int]byte{0: 0x80, 2: 0x01, 60: 0x00, 61: 0x80, 63: 0, 64: 0xA8, 65: 0}, ""},
+		{false, []int{0, 1}, nil, "Color 7 at 23,0 is not in the colors given"},
+		{false, []int{0, 1, 2}, nil, "Hires graphics need 2 colors"},
+		{false, []int{1, 1}, nil, "Color 1 is given more than once"},
+		{true, []int{0, 5, 6, 2}, nil, "Color 1 at 0,0 is not in the colors given"},
+		{true, nil, nil, "Multicolor graphics can only have 3 colors besides black"},
+	}
+	for _, test := range tests {
+		data, count, err := readSprites(sheet, test.multicolor, test.colors)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("expected error %q but got %v", test.err, err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("unexpected error %s", err.Error())
+			continue
+		}
+		if count != 2 || len(data) != 2*spriteBlock {
+			t.Errorf("expected 2 sprites but got %d in %d bytes", count, len(data))
+			continue
+		}
+		for offset, b := range test.expected {
+			if data[offset] != b {
+				t.Errorf("expected $%02x at %d but got $%02x", b, offset, data[offset])
+			}
+		}
+	}
+
+	// only the second sprite in multicolor
+	single := filepath.Join(dir, "single.png")
+	writeImage(t, single, spriteWidth, spriteHeight, map[[2]int]int{{0, 0}: 2, {2, 0}: 5, {4, 0}: 6, {6, 0}: -1})
+	data, _, err := readSprites(single, true, []int{0, 5, 2, 6})
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if data[0] != 0x9C { // 10 01 11 00
+		t.Errorf("expected $9c but got $%02x", data[0])
+	}
+}
+
+func TestSpriteInclude(t *testing.T) {
+	defer resetSymbols()
+
+	dir := t.TempDir()
+	writeImage(t, filepath.Join(dir, "ship.png"), 2*spriteWidth, spriteHeight, map[[2]int]int{{0, 0}: 1})
+	source := strings.Join([]string{
+		".org $2000",
+		"\tlda #ship.ptr",
+		"\tldx #ship.count",
+		".org $2040",
+		"./sprite ship.png",
+		"enemy ./sprite ship.png colors=0,1",
+	}, "\n")
+	filename := filepath.Join(dir, "sprite.asm")
+	if err := ioutil.WriteFile(filename, []byte(source), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	asm := assembleTestFile(t, filename)
+	if asm.program[2] != 0xA9 || asm.program[3] != 0x81 || asm.program[5] != 2 {
+		t.Errorf("expected the sprite pointer and count but got % x", asm.program[2:6])
+	}
+	if asm.program[2+0x40] != 0x80 {
+		t.Errorf("expected the sprites at $2040")
+	}
+	if symbols["enemy.ptr"] != 0x83 || symbols["enemy.count"] != 2 {
+		t.Errorf("expected the symbols named after the label")
+	}
+	if len(asm.messages) != 0 {
+		t.Errorf("expected no warnings but got %v", asm.messages)
+	}
+
+	// sprites out of the 64 bytes blocks still work, with a warning
+	source = ".org $2001\n./sprite ship.png\n"
+	if err := ioutil.WriteFile(filename, []byte(source), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	asm = assembleTestFile(t, filename)
+	if len(asm.messages) != 1 || !asm.messages[0].warning ||
+		!strings.HasSuffix(asm.messages[0].text, ":2:Sprites at $2001 are not aligned to 64 bytes") {
+		t.Errorf("expected a warning about the alignment but got %v", asm.messages)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// the file name in tape headers and T64 entries
+const tapeNameLen = 16
+
+// -----------------------------------------------------------------------------
+// T64:
+// -----------------------------------------------------------------------------
+
+// T64 is a container of files as found in a tape, a 64 bytes header
+// followed by a directory of 32 bytes entries and the files' data
+
+const (
+	t64Signature  = "C64S tape image file"
+	t64Version    = 0x0101
+	t64MaxEntries = 30
+	t64EntryLen   = 32
+	t64HeaderLen  = 64
+	t64NameLen    = 24
+	t64EntryTape  = 1
+	t64TypePRG    = 0x82
+)
+
+// t64Image wraps a PRG (load address included) in a T64 container
+func t64Image(name string, program []byte) ([]byte, error) {
+
+	load := int(program[0]) | int(program[1])<<8
+	data := program[2:]
+	dataOffset := t64HeaderLen + t64MaxEntries*t64EntryLen
+	end, endErr := tapeEndAddr(load, data)
+	if endErr != nil {
+		return nil, endErr
+	}
+
+	buffer := new(bytes.Buffer)
+
+	// header
+	signature := make([]byte, 32)
+	copy(signature, t64Signature)
+	buffer.Write(signature)
+	// version, entries and used entries
+	for _, v := range []interface{}{uint16(t64Version), uint16(t64MaxEntries), uint16(1), uint16(0)} {
+		if bWriteErr := binary.Write(buffer, binary.LittleEndian, v); bWriteErr != nil {
+			return nil, bWriteErr
+		}
+	}
+	buffer.Write(tapeFileName(name, t64NameLen))
+
+	// directory, only the first entry is used
+	buffer.Write([]byte{t64EntryTape, t64TypePRG})
+	for _, v := range []interface{}{uint16(load), uint16(end), uint16(0), uint32(dataOffset), uint32(0)} {
+		if bWriteErr := binary.Write(buffer, binary.LittleEndian, v); bWriteErr != nil {
+			return nil, bWriteErr
+		}
+	}
+	buffer.Write(tapeFileName(name, tapeNameLen))
+	buffer.Write(make([]byte, (t64MaxEntries-1)*t64EntryLen))
+
+	buffer.Write(data)
+	return buffer.Bytes(), nil
+}
+
+// -----------------------------------------------------------------------------
+// TAP:
+// -----------------------------------------------------------------------------
+
+// TAP files hold the raw pulses read from a tape, each byte is the
+// length of a pulse in cycles divided by 8. A program is recorded
+// with the KERNAL's standard encoding: a header block and a data
+// block, both of them recorded twice.
+//
+// Each block starts with a leader of short pulses followed by a sync
+// countdown ($89..$81 for the first copy, $09..$01 for the repeat),
+// the data and a checksum byte. Bytes start with a (long, medium)
+// marker followed by 8 bits (LSB first) and an odd parity bit,
+// where a 0 bit is (short, medium) and a 1 bit is (medium, short).
+
+const (
+	tapSignature = "C64-TAPE-RAW"
+	tapVersion   = 1
+
+	tapShort  = 0x30
+	tapMedium = 0x42
+	tapLong   = 0x56
+
+	tapHeaderLeader = 0x6A00
+	tapDataLeader   = 0x1500
+	tapRepeatLeader = 0x4F
+	tapTrailer      = 0x4E
+	tapPause        = 400000 // cycles of silence after each block
+
+	tapHeaderLen     = 192
+	tapTypeBasic     = 0x01 // relocatable, loads at the start of BASIC
+	tapTypeAbsolute  = 0x03 // loads at the address in the header
+	tapBasicLoadAddr = 0x0801
+)
+
+type tapEncoder struct {
+	buffer *bytes.Buffer
+}
+
+func (te tapEncoder) pulses(n int, pulse byte) {
+	for i := 0; i < n; i++ {
+		te.buffer.WriteByte(pulse)
+	}
+}
+
+func (te tapEncoder) bit(b byte) {
+	if b&1 == 0 {
+		te.buffer.Write([]byte{tapShort, tapMedium})
+	} else {
+		te.buffer.Write([]byte{tapMedium, tapShort})
+	}
+}
+
+func (te tapEncoder) byte(b byte) {
+	parity := byte(1)
+	te.buffer.Write([]byte{tapLong, tapMedium})
+	for i := uint(0); i < 8; i++ {
+		te.bit(b >> i)
+		parity ^= (b >> i) & 1
+	}
+	te.bit(parity)
+}
+
+// block writes the two copies of a block of data
+func (te tapEncoder) block(leader int, data []byte) {
+	for copyNum := 0; copyNum < 2; copyNum++ {
+		if copyNum == 0 {
+			te.pulses(leader, tapShort)
+		} else {
+			te.pulses(tapRepeatLeader, tapShort)
+		}
+
+		sync := byte(0x89)
+		if copyNum == 1 {
+			sync = 0x09
+		}
+		for i := byte(0); i < 9; i++ {
+			te.byte(sync - i)
+		}
+
+		checksum := byte(0)
+		for _, b := range data {
+			te.byte(b)
+			checksum ^= b
+		}
+		te.byte(checksum)
+
+		// end of data marker
+		te.buffer.Write([]byte{tapLong, tapShort})
+	}
+	te.pulses(tapTrailer, tapShort)
+
+	// pauses are a zero followed by the
+	// length in cycles (24 bits little endian)
+	pause := tapPause
+	te.buffer.Write([]byte{0, byte(pause), byte(pause >> 8), byte(pause >> 16)})
+}
+
+// tapImage records a PRG (load address included) as tape pulses
+func tapImage(name string, program []byte) ([]byte, error) {
+
+	load := int(program[0]) | int(program[1])<<8
+	data := program[2:]
+	end, endErr := tapeEndAddr(load, data)
+	if endErr != nil {
+		return nil, endErr
+	}
+
+	header := make([]byte, tapHeaderLen)
+	header[0] = tapTypeAbsolute
+	if load == tapBasicLoadAddr {
+		header[0] = tapTypeBasic
+	}
+	binary.LittleEndian.PutUint16(header[1:], uint16(load))
+	binary.LittleEndian.PutUint16(header[3:], uint16(end))
+
+	// the KERNAL fills the rest of the header after the name with spaces
+	copy(header[5:], tapeFileName(name, tapeNameLen))
+	copy(header[5+tapeNameLen:], bytes.Repeat([]byte{' '}, tapHeaderLen-5-tapeNameLen))
+
+	te := tapEncoder{buffer: new(bytes.Buffer)}
+	te.block(tapHeaderLeader, header)
+	te.block(tapDataLeader, data)
+
+	buffer := new(bytes.Buffer)
+	buffer.WriteString(tapSignature)
+	buffer.Write([]byte{tapVersion, 0, 0, 0})
+	if bWriteErr := binary.Write(buffer, binary.LittleEndian, uint32(te.buffer.Len())); bWriteErr != nil {
+		return nil, bWriteErr
+	}
+	buffer.Write(te.buffer.Bytes())
+	return buffer.Bytes(), nil
+}
+
+// tapeEndAddr returns the address after the data, headers keep
+// it in 16 bits so the data can't go up to $ffff
+func tapeEndAddr(load int, data []byte) (int, error) {
+	end := load + len(data)
+	if end > 0xFFFF {
+		return 0, fmt.Errorf("Program ending at $%04x can't be saved to tape, its end address $%x doesn't fit in 16 bits", end-1, end)
+	}
+	return end, nil
+}
+
+// tapeFileName converts the name to upper case
+// PETSCII and pads it with spaces as in tapes
+func tapeFileName(name string, size int) []byte {
+	b := []byte(strings.ToUpper(name))
+	if len(b) > size {
+		b = b[:size]
+	}
+	for len(b) < size {
+		b = append(b, ' ')
+	}
+	return b
+}
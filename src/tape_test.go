@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// readTapBlocks decodes the bytes of each block
+// of a TAP recording, sync countdown included
+func readTapBlocks(t *testing.T, pulses []byte) [][]byte {
+	blocks := [][]byte{}
+	block := []byte{}
+
+	for i := 0; i < len(pulses); {
+		switch {
+		case pulses[i] == 0:
+			i += 4
+		case pulses[i] == tapShort:
+			i++
+		case pulses[i] == tapLong && pulses[i+1] == tapShort:
+			blocks = append(blocks, block)
+			block = []byte{}
+			i += 2
+		case pulses[i] == tapLong && pulses[i+1] == tapMedium:
+			i += 2
+			b, parity := byte(0), byte(1)
+			for bit := uint(0); bit < 9; bit++ {
+				v := byte(0)
+				if pulses[i] == tapMedium {
+					v = 1
+				}
+				if bit < 8 {
+					b |= v << bit
+				} else if v != parity {
+					t.Fatalf("wrong parity bit at pulse %d", i)
+				}
+				parity ^= v
+				i += 2
+			}
+			block = append(block, b)
+		default:
+			t.Fatalf("unexpected pulse $%02x at %d", pulses[i], i)
+		}
+	}
+	return blocks
+}
+
+func TestTapImage(t *testing.T) {
+	program := []byte{0x00, 0xC0, 0xA9, 0x01, 0x8D, 0x20, 0xD0, 0x60}
+
+	tap, err := tapImage("test", program)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if string(tap[:12]) != tapSignature {
+		t.Fatalf("wrong signature %q", tap[:12])
+	}
+	if size := int(binary.LittleEndian.Uint32(tap[16:])); size != len(tap)-20 {
+		t.Fatalf("expected data size %d but got %d", len(tap)-20, size)
+	}
+
+	blocks := readTapBlocks(t, tap[20:])
+	if len(blocks) != 4 {
+		t.Fatalf("expected 4 blocks but got %d", len(blocks))
+	}
+
+	header := append([]byte{tapTypeAbsolute, 0x00, 0xC0, 0x06, 0xC0}, []byte("TEST")...)
+	for i, b := range blocks {
+		sync := []byte{0x89, 0x88, 0x87, 0x86, 0x85, 0x84, 0x83, 0x82, 0x81}
+		if i%2 == 1 {
+			for s := range sync {
+				sync[s] &= 0x7F
+			}
+		}
+		if !bytes.Equal(b[:9], sync) {
+			t.Errorf("block %d: wrong sync % x", i, b[:9])
+		}
+
+		data := b[9 : len(b)-1]
+		checksum := byte(0)
+		for _, d := range data {
+			checksum ^= d
+		}
+		if checksum != b[len(b)-1] {
+			t.Errorf("block %d: wrong checksum", i)
+		}
+
+		if i < 2 {
+			if len(data) != tapHeaderLen || !bytes.HasPrefix(data, header) {
+				t.Errorf("block %d: wrong header % x", i, data[:16])
+			}
+		} else if !bytes.Equal(data, program[2:]) {
+			t.Errorf("block %d: wrong data % x", i, data)
+		}
+	}
+}
+
+func TestT64Image(t *testing.T) {
+	program := []byte{0x01, 0x08, 0x0B, 0x08, 0x0A, 0x00}
+
+	t64, err := t64Image("test", program)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	entry := t64[t64HeaderLen:]
+	offset := int(binary.LittleEndian.Uint32(entry[8:]))
+
+	if binary.LittleEndian.Uint16(entry[2:]) != 0x0801 || binary.LittleEndian.Uint16(entry[4:]) != 0x0805 {
+		t.Errorf("wrong addresses in entry % x", entry[:6])
+	}
+	if string(entry[16:32]) != "TEST            " {
+		t.Errorf("wrong file name %q", entry[16:32])
+	}
+	if !bytes.Equal(t64[offset:], program[2:]) {
+		t.Errorf("wrong data % x", t64[offset:])
+	}
+}
+
+func TestTapeNames(t *testing.T) {
+	program := []byte{0x00, 0xC0, 0x60}
+	name := "a name longer than sixteen"
+
+	tap, err := tapImage(name, program)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	header := readTapBlocks(t, tap[20:])[0][9:]
+	expected := append([]byte{tapTypeAbsolute, 0x00, 0xC0, 0x01, 0xC0}, "A NAME LONGER TH"...)
+	expected = append(expected, bytes.Repeat([]byte{' '}, tapHeaderLen-len(expected))...)
+	if !bytes.Equal(header[:tapHeaderLen], expected) {
+		t.Errorf("tap: expected the header\n% x\nbut got\n% x", expected, header[:tapHeaderLen])
+	}
+
+	t64, err := t64Image(name, program)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if entry := t64[t64HeaderLen:]; string(entry[16:32]) != "A NAME LONGER TH" {
+		t.Errorf("t64: wrong file name %q", entry[16:32])
+	}
+}
+
+func TestTapeEndAddress(t *testing.T) {
+	// the last byte at $ffff would need $10000 as the end address
+	program := []byte{0xFE, 0xFF, 0x01, 0x02}
+	expected := "Program ending at $ffff can't be saved to tape, its end address $10000 doesn't fit in 16 bits"
+
+	if _, err := tapImage("test", program); err == nil || err.Error() != expected {
+		t.Errorf("tap: expected error %s but got %v", expected, err)
+	}
+	if _, err := t64Image("test", program); err == nil || err.Error() != expected {
+		t.Errorf("t64: expected error %s but got %v", expected, err)
+	}
+	if _, err := tapImage("test", program[:3]); err != nil {
+		t.Errorf("tap: unexpected error %s for data ending at $fffe", err.Error())
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Text in the encodings of the C64:
+//
+//	.scr "hello"		screen codes
+//	.petscii "hello"	PETSCII, for CHROUT and friends
+//	.ascii "hello"		the bytes as they are
+//
+// `.text` (and the strings in other data directives) use the encoding
+// chosen with `.encoding`, screen codes as ACME's conversion by default.
+//
+// `.textmode upper` is for the uppercase and graphics character set,
+// where letters of both cases are written as uppercase, and `.textmode
+// mixed` (the default) for the lowercase one. `.textmode reverse` sets
+// the reverse video bit of the screen codes until `.textmode normal`.
+//
+// The text is UTF-8, with the graphic characters written as their
+// Unicode equivalents (`♥`, `─`, `▒`...) and control codes between
+// braces as in listings (`{clr}`, `{red}`, `{rvs on}`, `{$93}`).
+//
+// `.charmap "{characters}", {first}` maps the characters to the byte
+// of the first one and the ones after it, for custom fonts, and is
+// used before any encoding. `.charmap` alone drops all the mappings.
+//
+//	.charmap "0123456789", $30
+//	.charmap "abcdefghijklmnopqrstuvwxyz", $41
+
+const (
+	reverseBit = 0x80
+	caseOffset = 'a' - 'A'
+)
+
+// textEncoder keeps the text settings as the lines are laid out
+type textEncoder struct {
+	encoding string // .SCR, .PETSCII or .ASCII
+	upper    bool
+	reverse  bool
+	charmap  map[rune]byte
+}
+
+func newTextEncoder() *textEncoder {
+	return &textEncoder{encoding: ".SCR", charmap: map[rune]byte{}}
+}
+
+// isText tells if the directive writes text
+func isText(mnemonic string) bool {
+	switch mnemonic {
+	case ".TEXT", ".SCR", ".PETSCII", ".ASCII":
+		return true
+	}
+	return false
+}
+
+// isTextSetting tells if the directive
+// changes how text is written
+func isTextSetting(mnemonic string) bool {
+	return mnemonic == ".TEXTMODE" || mnemonic == ".CHARMAP" || mnemonic == ".ENCODING"
+}
+
+// set applies a .textmode, .charmap or .encoding line
+func (e *textEncoder) set(mnemonic string, args []string) error {
+	if mnemonic == ".ENCODING" {
+		e.encoding = args[0]
+		return nil
+	} else if mnemonic == ".TEXTMODE" {
+		for _, mode := range args {
+			switch mode {
+			case "upper", "mixed":
+				e.upper = mode == "upper"
+			case "reverse", "normal":
+				e.reverse = mode == "reverse"
+			}
+		}
+		return nil
+	}
+
+	if len(args) == 0 {
+		e.charmap = map[rune]byte{}
+		return nil
+	}
+	chars := []rune(args[0])
+	first, err := resolveExpression(args[1])
+	if err != nil {
+		return err
+	} else if first < 0 || first+len(chars) > 0x100 {
+		return fmt.Errorf("Characters mapped from $%02x go past $ff", first)
+	}
+	for i, r := range chars {
+		e.charmap[r] = byte(first + i)
+	}
+	return nil
+}
+
+// encode converts the text for the directive
+func (e *textEncoder) encode(mnemonic string, text []byte) ([]byte, error) {
+	if mnemonic != ".SCR" && mnemonic != ".PETSCII" && mnemonic != ".ASCII" {
+		mnemonic = e.encoding
+	}
+	screen := mnemonic == ".SCR"
+	reverse := e.reverse
+
+	data := []byte{}
+	for s := string(text); s != ""; {
+
+		// control codes and values between braces
+		if s[0] == '{' {
+			end := strings.IndexByte(s, '}')
+			if end < 0 {
+				return nil, fmt.Errorf("Missing } after %s", s)
+			}
+			codes, err := e.escape(mnemonic, s[1:end], &reverse)
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, codes...)
+			s = s[end+1:]
+			continue
+		}
+
+		// escaped characters are taken as they are
+		r, size := utf8.DecodeRuneInString(s)
+		if r == '\\' {
+			if len(s) < 2 || !isEscapable(s[1]) {
+				return nil, escapeError(string(text), len(text)-len(s))
+			}
+			r, size = rune(s[1]), 2
+		}
+		s = s[size:]
+		b, err := e.encodeRune(mnemonic, r)
+		if err != nil {
+			return nil, err
+		}
+		if screen && reverse {
+			b |= reverseBit
+		}
+		data = append(data, b)
+	}
+	return data, nil
+}
+
+// encodeRune converts a character for the directive
+func (e *textEncoder) encodeRune(mnemonic string, r rune) (byte, error) {
+	if b, mapped := e.charmap[r]; mapped {
+		return b, nil
+	}
+
+	if r >= utf8.RuneSelf {
+		code, found := unicodePetscii[r]
+		switch {
+		case mnemonic == ".ASCII":
+			return 0, fmt.Errorf("Character %q is not ASCII", r)
+		case !found:
+			return 0, fmt.Errorf("Character %q has no PETSCII equivalent", r)
+		case mnemonic == ".PETSCII":
+			return code, nil
+		}
+		sc, _ := petsciiToScreenCode(code)
+		return sc, nil
+	}
+
+	c := byte(r)
+	if e.upper && c >= 'A' && c <= 'Z' && mnemonic != ".ASCII" {
+		c += caseOffset
+	}
+	switch mnemonic {
+	case ".SCR":
+		return encodeForC64Screen(c), nil
+	case ".PETSCII":
+		return asciiToPetscii(c)
+	}
+	return c, nil
+}
+
+// escape reads the codes between braces. Screen codes have no control
+// codes, there {rvs on} and {rvs off} switch the reverse video for the
+// rest of the text and only values like {$a0} are written as they are.
+func (e *textEncoder) escape(mnemonic, name string, reverse *bool) ([]byte, error) {
+	codes, err := readPetsciiEscape(name)
+	if err != nil || mnemonic != ".SCR" {
+		return codes, err
+	}
+
+	fields := strings.Fields(name)
+	switch {
+	case strings.HasPrefix(fields[len(fields)-1], "$"):
+		return codes, nil
+	case codes[0] == petsciiControlCodes["rvs on"]:
+		*reverse = true
+	case codes[0] == petsciiControlCodes["rvs off"]:
+		*reverse = false
+	default:
+		return nil, fmt.Errorf("Control code {%s} can't be written as screen codes", name)
+	}
+	return []byte{}, nil
+}
+
+// readTextMode checks the modes of a .textmode line
+func readTextMode(rawoper string) ([]string, error) {
+	modes := strings.Fields(strings.ToLower(rawoper))
+	if len(modes) == 0 {
+		return nil, fmt.Errorf("Syntax error, .textmode needs upper, mixed, reverse or normal")
+	}
+	for _, mode := range modes {
+		switch mode {
+		case "upper", "mixed", "reverse", "normal":
+		default:
+			return nil, fmt.Errorf("Unknown text mode %s, expecting upper, mixed, reverse or normal", mode)
+		}
+	}
+	return modes, nil
+}
+
+// readCharmap checks the characters and the first byte of a .charmap line
+func readCharmap(rawoper string) ([]string, error) {
+	if rawoper == "" {
+		return []string{}, nil
+	}
+	args := splitArgs(rawoper)
+	if len(args) != 2 {
+		return nil, fmt.Errorf("Syntax error in %s, expecting \"{characters}\", {first}", rawoper)
+	}
+	chars, quoted, err := readQuoted(args[0])
+	if err != nil {
+		return nil, err
+	} else if !quoted || chars == "" {
+		return nil, fmt.Errorf("Syntax error in %s, expecting the characters between quotes", args[0])
+	} else if !utf8.ValidString(chars) {
+		return nil, fmt.Errorf("%s is not a valid UTF-8 text", chars)
+	}
+	return []string{chars, args[1]}, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTextEncodings(t *testing.T) {
+	defer resetSymbols()
+
+	var tests = []struct {
+		lines    []string
+		expected []byte
+		err      string
+	}{
+		{[]string{".text \"Hi@[\""}, []byte{0x48, 0x09, 0x00, 0x1B}, ""},
+		{[]string{".scr \"Hi@[\""}, []byte{0x48, 0x09, 0x00, 0x1B}, ""},
+		{[]string{".petscii \"Hi!\""}, []byte{0xC8, 0x49, 0x21}, ""},
+		{[]string{".ascii \"Hi!\""}, []byte{0x48, 0x69, 0x21}, ""},
+		{[]string{".textmode upper", ".scr \"Hi\"", ".petscii \"Hi\"", ".ascii \"Hi\""}, []byte{0x08, 0x09, 0x48, 0x49, 0x48, 0x69}, ""},
+		{[]string{".textmode reverse", ".scr \"a\"", ".petscii \"a\"", ".textmode normal", ".scr \"a\""}, []byte{0x81, 0x41, 0x01}, ""},
+		{[]string{".charmap \"0123\", $f0", ".scr \"a01\"", ".ascii \"3\"", ".charmap", ".scr \"0\""}, []byte{0x01, 0xF0, 0xF1, 0xF3, 0x30}, ""},
+		{[]string{"first = $10", ".charmap \",.\", first", ".textmode reverse", ".scr \",.\""}, []byte{0x90, 0x91}, ""},
+		{[]string{".charmap \"ab\", $ff"}, nil, ":2:Characters mapped from $ff go past $ff"},
+		{[]string{".petscii \"~\""}, nil, ":2:Character '~' has no PETSCII equivalent"},
+		// control codes and graphics
+		{[]string{".petscii \"{clr}{2 down}{Red}a{$c1}\""}, []byte{0x93, 0x11, 0x11, 0x1C, 0x41, 0xC1}, ""},
+		{[]string{".petscii \"♥─│▒£π\""}, []byte{0xD3, 0xC0, 0xDD, 0xA6, 0x5C, 0xDE}, ""},
+		{[]string{".scr \"♥─a{rvs on}a▒{rvs off}a{$a0}\""}, []byte{0x53, 0x40, 0x01, 0x81, 0xE6, 0x01, 0xA0}, ""},
+		{[]string{".charmap \"♥\", 1", ".scr \"♥\"", ".ascii \"{$ff}\""}, []byte{0x01, 0xFF}, ""},
+		{[]string{".scr \"{clr}\""}, nil, ":2:Control code {clr} can't be written as screen codes"},
+		{[]string{".petscii \"{bold}\""}, nil, ":2:Unknown control code {bold}"},
+		{[]string{".petscii \"{clr\""}, nil, ":2:Missing } after {clr"},
+		{[]string{".petscii \"€\""}, nil, ":2:Character '€' has no PETSCII equivalent"},
+		{[]string{".ascii \"♥\""}, nil, ":2:Character '♥' is not ASCII"},
+	}
+
+	for i, test := range tests {
+		asm, err := assembleLines(t, append([]string{"\t.org $2000"}, test.lines...))
+
+		if test.err != "" {
+			if err == nil || !strings.HasSuffix(err.Error(), test.err) {
+				t.Errorf("test %d: expected error %s but got %v", i, test.err, err)
+			}
+		} else if err != nil {
+			t.Errorf("test %d: unexpected error %s", i, err.Error())
+		} else if !bytes.Equal(asm.program[2:], test.expected) {
+			t.Errorf("test %d: expected % x but got % x", i, test.expected, asm.program[2:])
+		}
+	}
+}
+
+func TestTextSettingsSyntax(t *testing.T) {
+	var tests = []struct {
+		line string
+		err  string
+	}{
+		{".textmode upper reverse", ""},
+		{".textmode bold", "Unknown text mode bold, expecting upper, mixed, reverse or normal"},
+		{".textmode", "Syntax error, .textmode needs upper, mixed, reverse or normal"},
+		{".charmap \"abc\", 1", ""},
+		{".charmap abc, 1", "Syntax error in abc, expecting the characters between quotes"},
+		{".charmap \"abc\"", "Syntax error in \"abc\", expecting \"{characters}\", {first}"},
+	}
+	for _, test := range tests {
+		_, err := tokenizer{}.tokenize(test.line)
+		if test.err == "" && err != nil {
+			t.Errorf("%s: unexpected error %s", test.line, err.Error())
+		} else if test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("%s: expected error %q but got %v", test.line, test.err, err)
+		}
+	}
+}
@@ -12,12 +12,14 @@ type operand struct {
 	label    string
 	mode     string
 	defBytes []byte
+	args     []string // raw arguments for directives
 }
 
 type tokenizedLine struct {
 	label string
 	opc   opcode
 	opr   operand
+	loc   sourceLocation
 }
 
 type tokenizer struct {
@@ -29,6 +31,13 @@ func (t tokenizer) tokenize(l string) (*tokenizedLine, error) {
 	tokens := splitTokens(l)
 	tnum := len(tokens)
 
+	// directives taking the rest of the line as operand
+	if dl, dlOk, dlErr := t.tryTokenizeDirective(l, tokens); dlErr != nil {
+		return nil, dlErr
+	} else if dlOk {
+		return dl, nil
+	}
+
 	// handle case when an off line label
 	// is appended to an alias label in the
 	// next line
@@ -79,7 +88,7 @@ func (t tokenizer) tokenize(l string) (*tokenizedLine, error) {
 			}
 			tl.opr = *opr
 			// if it is first token has to be an opcode
-			opc, opcErr := readOpcode(tokens[0], tl.opr.mode)
+			opc, opcErr := readOpcodeForOperand(tokens[0], &tl.opr)
 			if opcErr != nil {
 				return nil, opcErr
 			}
@@ -120,7 +129,7 @@ func (t tokenizer) tokenize(l string) (*tokenizedLine, error) {
 			// and return any unhandled partial
 			return unhandled, saveSymbol(tl.label, opr.addr)
 		} else {
-			opc, opcErr := readOpcode(tokens[1], tl.opr.mode)
+			opc, opcErr := readOpcodeForOperand(tokens[1], &tl.opr)
 			if opcErr != nil {
 				return nil, opcErr
 			}
@@ -178,6 +187,36 @@ func (t tokenizer) tryTokenizeInstruction(tokens []string, tnum int) (*tokenized
 	return nil, false, nil
 }
 
+// Directives whose operand may contain spaces (like conditions)
+// take the whole rest of the line, with an optional label before.
+//
+func (t tokenizer) tryTokenizeDirective(l string, tokens []string) (*tokenizedLine, bool, error) {
+
+	var tl tokenizedLine
+
+	dir := 0
+	if len(tokens) > 1 && !isFreeFormDirective(tokens[0]) && isFreeFormDirective(tokens[1]) {
+		tl.label = tokens[0]
+		dir = 1
+	} else if !isFreeFormDirective(tokens[0]) {
+		return nil, false, nil
+	}
+
+	// skip the label and the directive itself
+	rest := l
+	for i := 0; i <= dir; i++ {
+		rest = strings.TrimSpace(rest[strings.Index(rest, tokens[i])+len(tokens[i]):])
+	}
+
+	tl.opc = *readPseudoOpcode(tokens[dir])
+	opr, oprErr := t.readPseudoOperand(rest, tokens[dir])
+	if oprErr != nil {
+		return nil, true, oprErr
+	}
+	tl.opr = *opr
+	return &tl, true, nil
+}
+
 // -----------------------------------------------------------------------------
 // Read opcodes & pseudo-opcodes:
 // -----------------------------------------------------------------------------
@@ -197,8 +236,31 @@ func readOpcode(oc, mode string) (opcode, error) {
 	return roc, nil
 }
 
+// readOpcodeForOperand reads the opcode for the mode of the operand,
+// when there's no zero page version of the instruction (like
+// `lda $10,y` or `jmp $10`) the absolute one is used instead
+func readOpcodeForOperand(oc string, opr *operand) (opcode, error) {
+	opc, opcErr := readOpcode(oc, opr.mode)
+	if opcErr == nil {
+		return opc, nil
+	}
+	if absMode, found := zeroPageToAbsolute[opr.mode]; found {
+		if absOpc, absErr := readOpcode(oc, absMode); absErr == nil {
+			opr.mode = absMode
+			return absOpc, nil
+		}
+	}
+	return opc, opcErr
+}
+
+var zeroPageToAbsolute = map[string]string{
+	ZP:  ABS,
+	ZPX: ABSX,
+	ZPY: ABSY,
+}
+
 func readPseudoOpcode(poc string) *opcode {
-	lookupKey := fmt.Sprintf(strings.ToUpper(poc))
+	lookupKey := strings.ToUpper(poc)
 	rpoc, found := pseudoOpcodes[lookupKey]
 	if !found {
 		return nil
@@ -228,20 +290,23 @@ func readAddress(a string) (int, string, error) {
 	if a[0] == '$' {
 		// since we can't specify 'unsigned' use 32 bit int
 		val, err = strconv.ParseInt(a[1:], 16, 32)
-	} else if a[0] == 'o' {
-		val, err = strconv.ParseInt(a[1:], 8, 32)
-	} else if a[0] == 'b' {
-		val, err = strconv.ParseInt(a[1:], 2, 32)
+	} else if a[0] == 'o' || a[0] == 'b' {
+		base := 8
+		if a[0] == 'b' {
+			base = 2
+		}
+		val, err = strconv.ParseInt(a[1:], base, 32)
 	} else {
 		val, err = strconv.ParseInt(a, 10, 32)
-		if conversionError, ok := err.(*strconv.NumError); ok {
-			if conversionError.Err == strconv.ErrSyntax {
-				if isOpcode(a) {
-					return 0, "", fmt.Errorf("Cannot use opcode %s as a label", a)
-				}
-				// it's a label or a formula
-				return -1, a, nil
+	}
+	if conversionError, ok := err.(*strconv.NumError); ok && a[0] != '$' {
+		if conversionError.Err == strconv.ErrSyntax {
+			if isOpcode(a) {
+				return 0, "", fmt.Errorf("Cannot use opcode %s as a label", a)
 			}
+			// it's a label or a formula (labels can also
+			// start with `b` or `o` when not a number)
+			return -1, a, nil
 		}
 	}
 	return int(val), "", err
@@ -255,7 +320,7 @@ func readIndirect(ro string) (*operand, error) {
 	var addrErr error
 
 	if strings.HasSuffix(ro, ")") {
-		noParens := ro[1 : len(ro)-2]
+		noParens := ro[:len(ro)-1]
 		if sploper := strings.Split(noParens, ","); len(sploper) > 2 {
 			return nil, fmt.Errorf("Syntax error in operand %s", ro)
 		} else if len(sploper) == 2 {
@@ -279,7 +344,7 @@ func readIndirect(ro string) (*operand, error) {
 			if !strings.HasSuffix(sploper[0], ")") {
 				return nil, fmt.Errorf("Syntax error, missing ')' in operand %s", ro)
 			}
-			noParens := sploper[0][1 : len(sploper[0])-2]
+			noParens := sploper[0][:len(sploper[0])-1]
 			// Indirect,Y
 			addrVal, addrLabel, addrErr = readAddress(noParens)
 			opr.mode = IY
@@ -420,7 +485,6 @@ func (t tokenizer) readOperand(rawoper, opc string) (*operand, error) {
 			return nil, fmt.Errorf("Out of range value in operand %s", rawoper)
 		}
 	}
-	return nil, fmt.Errorf("Syntax error in operand %s", rawoper)
 }
 
 func (t tokenizer) readPseudoOperand(rawoper, opc string) (*operand, error) {
@@ -432,43 +496,291 @@ func (t tokenizer) readPseudoOperand(rawoper, opc string) (*operand, error) {
 		} else {
 			return &operand{addr: addrVal, label: addrLabel, mode: NOMODE}, nil
 		}
-	case ".TEXT":
-		if !isAsciiString(rawoper) {
-			return nil, fmt.Errorf("%s is not a valid ASCII text", rawoper)
-		}
-		return &operand{defBytes: []byte(rawoper), mode: NOMODE}, nil
-	case "DFB":
-		chunks := strings.Split(rawoper, ",")
-		dfbValues := []byte{}
-		for _, c := range chunks {
-			if c == "" {
-				continue
+	case ".BANK":
+		bank, bankLabel, bankErr := readAddress(rawoper)
+		if bankErr != nil || bankLabel != "" {
+			return nil, fmt.Errorf("Invalid bank number %s", rawoper)
+		}
+		return &operand{addr: bank, mode: NOMODE}, nil
+	case ".TEXT", ".SCR", ".PETSCII", ".ASCII", ".CSTRING", ".PSTRING", ".HSTRING", "DFB":
+		// {directive} {string or value}[, {string or value}...]
+		items, listErr := readDataList(strings.ToUpper(opc), rawoper)
+		if listErr != nil {
+			return nil, listErr
+		}
+		return &operand{args: items, mode: NOMODE}, nil
+	case "./BIN":
+		// ./BIN {filename} [skip={n}] [length={n}] [prg [org]]
+		args := splitTokens(rawoper)
+		if len(args) == 0 {
+			return nil, fmt.Errorf("Syntax error, ./bin needs a file name")
+		}
+
+		// without options the whole operand is the file name, spaces
+		// included, with them a name with spaces has to be quoted
+		options := false
+		for _, arg := range args[1:] {
+			lower := strings.ToLower(arg)
+			options = options || strings.Contains(lower, "=") || lower == binPRG || lower == binOrigin
+		}
+		if !options && len(args) > 1 {
+			args = []string{rawoper}
+		}
+
+		skip, length, mode := 0, -1, ""
+		for _, arg := range args[1:] {
+			kv := strings.SplitN(strings.ToLower(arg), "=", 2)
+			switch {
+			case len(kv) == 2 && (kv[0] == "skip" || kv[0] == "length"):
+				v, vLabel, vErr := readAddress(kv[1])
+				if vErr != nil || vLabel != "" {
+					return nil, fmt.Errorf("Invalid %s %s, expecting a number", kv[0], kv[1])
+				}
+				if kv[0] == "skip" {
+					skip = v
+				} else {
+					length = v
+				}
+			case kv[0] == binPRG && mode == "":
+				mode = binPRG
+			case kv[0] == binOrigin && mode == binPRG:
+				mode = binOrigin
+			default:
+				return nil, fmt.Errorf("Syntax error in %s, expecting skip={n}, length={n}, prg or prg org (quote file names with spaces)", arg)
 			}
-			value, text, dataErr := readAddress(c)
-			if dataErr != nil {
-				return nil, fmt.Errorf("Syntax error in %s on DFB instruction", c)
-			} else if text != "" {
-				return nil, fmt.Errorf("Syntax error in %s on DFB instruction", c)
-			} else if value > 0xFF {
-				return nil,
-					fmt.Errorf(
-						"Value %s is out of range. Enter only values valid for a byte's range", c)
-			} else {
-				dfbValues = append(dfbValues, byte(value))
+		}
+		return &operand{
+			label: fmt.Sprintf("%s%c%s", t.currFPath, filepath.Separator, args[0]),
+			args:  []string{strconv.Itoa(skip), strconv.Itoa(length), mode},
+			mode:  NOMODE,
+		}, nil
+	case "./SID":
+		// ./SID {filename} [{prefix}]
+		args := splitTokens(rawoper)
+		if len(args) == 0 || len(args) > 2 {
+			return nil, fmt.Errorf("Syntax error in %s, expecting {filename} [{prefix}]", rawoper)
+		}
+		prefix := defaultSIDName
+		if len(args) == 2 {
+			if prefix = args[1]; !isValidLabel(prefix) {
+				return nil, fmt.Errorf("Invalid prefix %s for the SID symbols", prefix)
 			}
 		}
-		if len(dfbValues) == 0 {
-			return nil, fmt.Errorf("No valid data found for DFB instruction")
+		return &operand{
+			label: fmt.Sprintf("%s%c%s", t.currFPath, filepath.Separator, args[0]),
+			args:  []string{prefix},
+			mode:  NOMODE,
+		}, nil
+	case "./SPRITE", "./CHARSET", "./HIRES", "./KOALA":
+		// ./SPRITE {filename} [multicolor] [colors={c},{c}...]
+		// ./CHARSET {filename} [multicolor] [colors={c},{c}...] [dedup]
+		// ./HIRES {filename}
+		// ./KOALA {filename} [background={c}]
+		args := splitTokens(rawoper)
+		if len(args) == 0 {
+			return nil, fmt.Errorf("Syntax error, %s needs a file name", strings.ToLower(opc))
 		}
-		return &operand{defBytes: dfbValues, mode: NOMODE}, nil
-	case "./BIN":
+		options, optErr := readGraphicsOptions(strings.ToUpper(opc), args[1:])
+		if optErr != nil {
+			return nil, optErr
+		}
+		name := strings.TrimSuffix(filepath.Base(args[0]), filepath.Ext(args[0]))
+		return &operand{
+			label: fmt.Sprintf("%s%c%s", t.currFPath, filepath.Separator, args[0]),
+			args:  append([]string{name}, options...),
+			mode:  NOMODE,
+		}, nil
+	case "./BASIC":
 		return &operand{label: fmt.Sprintf("%s%c%s", t.currFPath, filepath.Separator, rawoper), mode: NOMODE}, nil
+	case "./DISK":
+		// ./DISK {filename} [{name on disk}]
+		args := splitTokens(rawoper)
+		if len(args) == 0 || len(args) > 2 {
+			return nil, fmt.Errorf("Syntax error in disk file %s", rawoper)
+		}
+		name := strings.TrimSuffix(filepath.Base(args[0]), filepath.Ext(args[0]))
+		if len(args) == 2 {
+			name = args[1]
+		}
+		return &operand{
+			label: fmt.Sprintf("%s%c%s", t.currFPath, filepath.Separator, args[0]),
+			args:  []string{name},
+			mode:  NOMODE,
+		}, nil
+	case ".BREAK":
+		// .BREAK [if {condition}]
+		cond, rest, condErr := readCondition(splitTokens(rawoper))
+		if condErr != nil {
+			return nil, condErr
+		} else if len(rest) > 0 {
+			return nil, fmt.Errorf("Syntax error in breakpoint %s", rawoper)
+		}
+		return &operand{args: []string{cond}, mode: NOMODE}, nil
+	case ".WATCH":
+		// .WATCH [load|store] {addr} [{end addr}] [if {condition}]
+		args := splitTokens(rawoper)
+		kind := ""
+		if len(args) > 0 && (strings.ToLower(args[0]) == "load" || strings.ToLower(args[0]) == "store") {
+			kind = strings.ToLower(args[0])
+			args = args[1:]
+		}
+		cond, rest, condErr := readCondition(args)
+		if condErr != nil {
+			return nil, condErr
+		} else if len(rest) == 0 || len(rest) > 2 {
+			return nil, fmt.Errorf("Syntax error in watchpoint %s", rawoper)
+		}
+		end := ""
+		if len(rest) == 2 {
+			end = rest[1]
+		}
+		return &operand{args: []string{kind, rest[0], end, cond}, mode: NOMODE}, nil
+	case ".BASIC_SYS":
+		// .BASIC_SYS {addr} [, {line number}]
+		args := strings.Split(rawoper, ",")
+		if len(args) > 2 || strings.TrimSpace(args[0]) == "" {
+			return nil, fmt.Errorf("Syntax error in BASIC line %s", rawoper)
+		}
+		target := strings.TrimSpace(args[0])
+		addrVal, addrLabel, addrErr := readAddress(target)
+		if addrErr != nil {
+			return nil, addrErr
+		}
+		lineNum := basicSysDefaultLine
+		if len(args) == 2 {
+			num, numErr := strconv.Atoi(strings.TrimSpace(args[1]))
+			if numErr != nil || num < 0 || num > basicMaxLine {
+				return nil, fmt.Errorf("Invalid BASIC line number %s", strings.TrimSpace(args[1]))
+			}
+			lineNum = num
+		}
+		return &operand{addr: addrVal, label: addrLabel, args: []string{strconv.Itoa(lineNum)}, mode: NOMODE}, nil
+	case ".TEST":
+		// .TEST {name}
+		if args := splitTokens(rawoper); len(args) != 1 {
+			return nil, fmt.Errorf("Syntax error in test name %s", rawoper)
+		}
+		return &operand{args: []string{rawoper}, mode: NOMODE}, nil
+	case ".SET", ".EXPECT":
+		// .SET {register, flag or address} = {value}
+		args := strings.SplitN(rawoper, "=", 2)
+		if len(args) != 2 || strings.TrimSpace(args[0]) == "" || strings.TrimSpace(args[1]) == "" {
+			return nil, fmt.Errorf("Syntax error in %s, expecting {register, flag or address} = {value}", rawoper)
+		}
+		target, value := strings.TrimSpace(args[0]), strings.TrimSpace(args[1])
+		if strings.ToUpper(opc) == ".EXPECT" && strings.ToLower(target) != "output" {
+			// registers and memory hold a byte, values of
+			// labels and formulas are checked when run
+			if v, label, vErr := readAddress(value); vErr == nil && label == "" && (v < 0 || v > 0xFF) {
+				return nil, fmt.Errorf("Value %s is out of range. Enter only values valid for a byte's range", value)
+			}
+		}
+		return &operand{args: []string{target, value}, mode: NOMODE}, nil
+	case ".CALL":
+		// .CALL {label or address}
+		if args := splitTokens(rawoper); len(args) != 1 {
+			return nil, fmt.Errorf("Syntax error in call %s", rawoper)
+		}
+		return &operand{args: []string{rawoper}, mode: NOMODE}, nil
+	case ".TEXTMODE":
+		// .TEXTMODE {upper|mixed} {reverse|normal}
+		modes, modeErr := readTextMode(rawoper)
+		if modeErr != nil {
+			return nil, modeErr
+		}
+		return &operand{args: modes, mode: NOMODE}, nil
+	case ".ENCODING":
+		// .ENCODING {scr|petscii|ascii}
+		encoding, encErr := readEncoding(rawoper)
+		if encErr != nil {
+			return nil, encErr
+		}
+		return &operand{args: encoding, mode: NOMODE}, nil
+	case ".CHARMAP":
+		// .CHARMAP ["{characters}", {first}]
+		args, mapErr := readCharmap(rawoper)
+		if mapErr != nil {
+			return nil, mapErr
+		}
+		return &operand{args: args, mode: NOMODE}, nil
+	case ".SPRITE", ".CHAR":
+		// .SPRITE [multicolor] or .CHAR [multicolor], with the rows until .END
+		if mode := strings.ToLower(rawoper); mode != "" && mode != "multicolor" {
+			return nil, fmt.Errorf("Syntax error in %s, expecting multicolor or nothing", rawoper)
+		}
+		return &operand{args: []string{strings.ToLower(rawoper)}, mode: NOMODE}, nil
+	case ".NOPAGECROSS":
+		if rawoper != "" {
+			return nil, fmt.Errorf("Syntax error, .nopagecross takes no operand")
+		}
+		return &operand{mode: NOMODE}, nil
+	case ".TIMED":
+		// .TIMED {cycles}
+		if args := splitTokens(rawoper); len(args) != 1 {
+			return nil, fmt.Errorf("Syntax error in %s, expecting the number of cycles", rawoper)
+		}
+		return &operand{args: []string{rawoper}, mode: NOMODE}, nil
+	case ".ASSERT":
+		// .ASSERT {condition} [, "{message}"]
+		args := splitArgs(rawoper)
+		if args[0] == "" || len(args) > 2 {
+			return nil, fmt.Errorf("Syntax error in assertion %s, expecting {condition} [, \"{message}\"]", rawoper)
+		}
+		msg := ""
+		if len(args) == 2 {
+			var quoted bool
+			var err error
+			if msg, quoted, err = readQuoted(args[1]); err != nil {
+				return nil, err
+			} else if !quoted {
+				return nil, fmt.Errorf("Syntax error in assertion message %s, expecting a quoted text", args[1])
+			}
+		}
+		return &operand{args: []string{args[0], msg}, mode: NOMODE}, nil
+	case ".ERROR", ".WARNING":
+		// .ERROR "{message}"
+		msg, quoted, err := readQuoted(rawoper)
+		if err != nil {
+			return nil, err
+		} else if !quoted {
+			return nil, fmt.Errorf("Syntax error in %s, expecting a quoted text", rawoper)
+		}
+		return &operand{args: []string{msg}, mode: NOMODE}, nil
+	case ".PRINT":
+		// .PRINT {"text" or expression} [, ...]
+		args := splitArgs(rawoper)
+		for _, arg := range args {
+			if arg == "" {
+				return nil, fmt.Errorf("Syntax error in %s, expecting texts or expressions", rawoper)
+			}
+		}
+		return &operand{args: args, mode: NOMODE}, nil
+	case ".END":
+		if rawoper != "" {
+			return nil, fmt.Errorf("Syntax error, .end takes no operand")
+		}
+		return &operand{mode: NOMODE}, nil
 	default:
 		// this should never be reached
 		panic(fmt.Sprintf("Unrecognized pseudo-opcode %s", opc))
 	}
 }
 
+// readCondition takes an optional trailing `if {formula}` from
+// the tokens of a directive and returns it with the remaining tokens
+func readCondition(tokens []string) (string, []string, error) {
+	for i, tok := range tokens {
+		if strings.ToLower(tok) != "if" {
+			continue
+		}
+		if i != len(tokens)-2 || tokens[i+1][0] != '[' {
+			return "", nil, fmt.Errorf("Syntax error, expecting a single [formula] after `if`")
+		}
+		return tokens[i+1], tokens[:i], nil
+	}
+	return "", tokens, nil
+}
+
 // -----------------------------------------------------------------------------
 // Misc. helpers:
 // -----------------------------------------------------------------------------
@@ -478,7 +790,7 @@ func splitTokens(line string) []string {
 	// This takes the line with the spaces
 	// before and after already trimmed so we only
 	// have to worry about the spaces in between and the
-	// double quoted text for .TEXT instructions
+	// double quoted strings
 
 	var p byte
 	var i int
@@ -498,28 +810,23 @@ func splitTokens(line string) []string {
 			i++
 			continue
 		} else if p == '"' {
-			// if we find a double quote take all the rest
-			// as text and also remove any double quote
-			// at the end
+			// a quoted string is a token of its own, the
+			// escapes are left for whoever reads the text
 
 			if tok != "" {
 				toks = append(toks, tok)
 			}
 
-			tok = line[i+1:]
-			i += len(line) - i
-
-			// note: this hacky solution has the pretty funny
-			// effect that you could totally ommit the " at the end
-			//
-			// 	¯\_(ツ)_/¯
-			//
-			if tok[len(tok)-1] == '"' {
-				tok = tok[:len(tok)-1]
+			// lines with a string missing its closing quote are
+			// reported by the parser, just take the rest
+			end, endErr := scanString(line, i)
+			if endErr != nil {
+				end = len(line) + 1
 			}
 
-			toks = append(toks, tok)
+			toks = append(toks, line[i+1:end-1])
 			tok = ""
+			i = end
 			continue
 		} else if p == '[' {
 			readingFormula++
@@ -538,6 +845,48 @@ func splitTokens(line string) []string {
 	return toks
 }
 
+// directives that get the whole rest of the line as operand
+var freeFormDirectives = map[string]bool{
+	".TEXT":        true,
+	".SCR":         true,
+	".PETSCII":     true,
+	".ASCII":       true,
+	".CSTRING":     true,
+	".PSTRING":     true,
+	".HSTRING":     true,
+	"DFB":          true,
+	"./BIN":        true,
+	"./SID":        true,
+	"./SPRITE":     true,
+	"./CHARSET":    true,
+	"./HIRES":      true,
+	"./KOALA":      true,
+	"./DISK":       true,
+	".BREAK":       true,
+	".WATCH":       true,
+	".BASIC_SYS":   true,
+	".TEST":        true,
+	".SET":         true,
+	".CALL":        true,
+	".EXPECT":      true,
+	".END":         true,
+	".ASSERT":      true,
+	".ERROR":       true,
+	".WARNING":     true,
+	".PRINT":       true,
+	".NOPAGECROSS": true,
+	".TIMED":       true,
+	".TEXTMODE":    true,
+	".CHARMAP":     true,
+	".ENCODING":    true,
+	".SPRITE":      true,
+	".CHAR":        true,
+}
+
+func isFreeFormDirective(tok string) bool {
+	return freeFormDirectives[strings.ToUpper(tok)]
+}
+
 func isWhitespaceOrTab(b byte) bool {
 	return b == ' ' || b == '\t'
 }
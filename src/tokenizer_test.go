@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTokenizeOperands(t *testing.T) {
+	tests := []struct {
+		line  string
+		mode  string
+		addr  int
+		label string
+		hex   uint8
+	}{
+		{"jmp ($1234)", IND, 0x1234, "", 0x6C},
+		{"jmp (vector)", IND, -1, "vector", 0x6C},
+		{"lda ($fb,x)", IX, 0xFB, "", 0xA1},
+		{"lda ($fb),y", IY, 0xFB, "", 0xB1},
+		{"sta (ptr),y", IY, -1, "ptr", 0x91},
+		// no zero page mode, so absolute
+		{"lda $10,y", ABSY, 0x10, "", 0xB9},
+		{"ldx $10,y", ZPY, 0x10, "", 0xB6},
+		{"jmp $10", ABS, 0x10, "", 0x4C},
+		{"jsr $ff", ABS, 0xFF, "", 0x20},
+	}
+	for _, test := range tests {
+		tl, err := tokenizer{}.tokenize(test.line)
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", test.line, err.Error())
+			continue
+		}
+		if tl.opr.mode != test.mode || tl.opr.addr != test.addr || tl.opr.label != test.label || tl.opc.hex != test.hex {
+			t.Errorf("%s: expected %s %d %q $%02x but got %s %d %q $%02x", test.line,
+				test.mode, test.addr, test.label, test.hex,
+				tl.opr.mode, tl.opr.addr, tl.opr.label, tl.opc.hex)
+		}
+	}
+}
+
+func TestReadAddress(t *testing.T) {
+	tests := []struct {
+		input string
+		value int
+		label string
+	}{
+		{"$d020", 0xD020, ""},
+		{"b1010", 10, ""},
+		{"o17", 15, ""},
+		{"53280", 53280, ""},
+		{"border", -1, "border"},
+		{"ball", -1, "ball"},
+		{"offset", -1, "offset"},
+	}
+	for _, test := range tests {
+		value, label, err := readAddress(test.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", test.input, err.Error())
+		} else if value != test.value || label != test.label {
+			t.Errorf("%s: expected %d %q but got %d %q", test.input, test.value, test.label, value, label)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+// The raster of the VIC-II for the simulator. The raster line counts
+// with the cycles as on a PAL C64 (63 cycles a line, 312 lines) and
+// reaching the line written to $D012 (bit 8 in bit 7 of $D011) sets
+// the raster bit of the interrupt latch at $D019. With it enabled at
+// $D01A the IRQ line stays low until the bit is written back to $D019.
+// The other registers are plain memory.
+
+const (
+	cyclesPerLine = 63
+	rasterLines   = 312
+
+	vicControl = 0xD011
+	vicRaster  = 0xD012
+	vicIRQ     = 0xD019
+	vicIRQMask = 0xD01A
+
+	irqRaster byte = 0x01
+)
+
+type vic struct {
+	lines   int // raster lines since the start
+	compare int
+	latch   byte
+	enable  byte
+}
+
+// raster returns the line being drawn
+func (v *vic) raster() int {
+	return v.lines % rasterLines
+}
+
+// advance moves the raster to where the cycles have taken it,
+// latching an interrupt on each line matching the compare one
+func (v *vic) advance(cycles int) {
+	for cycles/cyclesPerLine > v.lines {
+		v.lines++
+		if v.raster() == v.compare {
+			v.latch |= irqRaster
+		}
+	}
+}
+
+// irq tells if an enabled interrupt is latched
+func (v *vic) irq() bool {
+	return v.latch&v.enable&0x0F != 0
+}
+
+// read returns the registers kept by the raster, false for the others.
+// The registers repeat every 64 bytes from $D000 to $D3FF.
+func (v *vic) read(c *cpu, addr int) (byte, bool) {
+	switch 0xD000 | addr&0x3F {
+	case vicControl:
+		return c.mem[addr]&0x7F | byte(v.raster()>>8)<<7, true
+	case vicRaster:
+		return byte(v.raster()), true
+	case vicIRQ:
+		latch := v.latch | 0x70
+		if v.irq() {
+			latch |= 0x80
+		}
+		return latch, true
+	case vicIRQMask:
+		return v.enable | 0xF0, true
+	}
+	return 0, false
+}
+
+// write sets the compare line, acknowledges or enables the
+// interrupts, the rest of $D011 is kept in memory
+func (v *vic) write(c *cpu, addr int, value byte) {
+	switch 0xD000 | addr&0x3F {
+	case vicControl:
+		v.compare = v.compare&0xFF | int(value>>7)<<8
+		c.mem[addr] = value
+	case vicRaster:
+		v.compare = v.compare&0x100 | int(value)
+	case vicIRQ:
+		v.latch &^= value & 0x0F
+	case vicIRQMask:
+		v.enable = value & 0x0F
+	default:
+		c.mem[addr] = value
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRasterRegisters(t *testing.T) {
+	var tests = []struct {
+		cycles  int
+		raster  byte
+		control byte
+	}{
+		{0, 0x00, 0x1B},
+		{cyclesPerLine - 1, 0x00, 0x1B},
+		{cyclesPerLine, 0x01, 0x1B},
+		{cyclesPerLine * 0x100, 0x00, 0x9B},
+		{cyclesPerLine * (rasterLines - 1), 0x37, 0x9B},
+		{cyclesPerLine * rasterLines, 0x00, 0x1B},
+	}
+
+	for _, test := range tests {
+		c := newCPU()
+		c.vic = &vic{}
+		c.write(vicControl, 0x1B)
+		c.vic.advance(test.cycles)
+		if raster, control := c.read(vicRaster), c.read(vicControl); raster != test.raster || control != test.control {
+			t.Errorf("expected $d012=$%02x and $d011=$%02x after %d cycles but got $%02x and $%02x",
+				test.raster, test.control, test.cycles, raster, control)
+		}
+	}
+}
+
+func TestRasterCompare(t *testing.T) {
+	c := newCPU()
+	c.vic = &vic{}
+	c.write(vicRaster, 0x30)
+	c.write(vicControl, 0x80) // line $130
+	c.write(vicIRQMask, 0x01)
+
+	c.vic.advance(cyclesPerLine * 0x12F)
+	if c.vic.irq() {
+		t.Errorf("expected no interrupt before line $130")
+	}
+	c.vic.advance(cyclesPerLine * 0x130)
+	if !c.vic.irq() || c.read(vicIRQ) != 0xF1 {
+		t.Errorf("expected an interrupt on line $130 but got $d019=$%02x", c.read(vicIRQ))
+	}
+
+	// dec writes back the value read first, which acknowledges it
+	copy(c.mem[0x1000:], []byte{0xCE, 0x19, 0xD0}) // dec $d019
+	c.pc = 0x1000
+	if err := c.step(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if c.vic.irq() || c.read(vicIRQ) != 0x70 {
+		t.Errorf("expected the interrupt acknowledged but got $d019=$%02x", c.read(vicIRQ))
+	}
+}
+
+func TestRasterInterrupt(t *testing.T) {
+	defer resetSymbols()
+
+	asm, err := assembleLines(t, []string{
+		"\t.org $c000",
+		"\tsei",
+		"\tlda #[<b irq]",
+		"\tsta $0314",
+		"\tlda #[>b irq]",
+		"\tsta $0315",
+		"\tlda #$80",
+		"\tsta $d012",
+		"\tlda #$01",
+		"\tsta $d01a",
+		"\tcli",
+		"loop\tjmp loop",
+		"irq\tinc $02",
+		"\tdec $d019",
+		"\tjmp $ea31",
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	c := newCPU()
+	c.vic = &vic{}
+	installKernal(c)
+	c.load(asm.program)
+
+	limit := cyclesPerLine * rasterLines * 3
+	if _, err := runRoutine(c, asm.startAddr, limit, nil); err == nil {
+		t.Fatalf("expected the program looping until the limit")
+	}
+	if c.read(0x02) != 3 || c.sp != 0xFF || c.flag(flagI) {
+		t.Errorf("expected an interrupt each frame returning to the loop but got %d, SP=%02x, P=%02x",
+			c.read(0x02), c.sp, c.p)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// checkpoint is a breakpoint or watchpoint requested in the sources
+// with `.BREAK` or `.WATCH`, they don't take any space in memory so
+// only the address where they land is kept
+type checkpoint struct {
+	addr int
+	line *tokenizedLine
+}
+
+// resolvedCheckpoint is a checkpoint ready to be written out,
+// with all symbols and formulas resolved
+type resolvedCheckpoint struct {
+	watch  bool
+	access string // load or store for watchpoints, both if empty
+	start  int
+	end    int
+	cond   string // condition in VICE's monitor syntax
+}
+
+func resolveCheckpoint(cp checkpoint) (*resolvedCheckpoint, error) {
+
+	var rcp resolvedCheckpoint
+	var cond string
+	var err error
+
+	args := cp.line.opr.args
+
+	switch cp.line.opc.mnemonic {
+	case ".BREAK":
+		rcp.start = cp.addr
+		rcp.end = cp.addr
+		cond = args[0]
+	case ".WATCH":
+		rcp.watch = true
+		rcp.access = args[0]
+		if rcp.start, err = resolveExpression(args[1]); err != nil {
+			return nil, err
+		}
+		rcp.end = rcp.start
+		if args[2] != "" {
+			if rcp.end, err = resolveExpression(args[2]); err != nil {
+				return nil, err
+			}
+		}
+		cond = args[3]
+	default:
+		panic(fmt.Sprintf("Not a checkpoint %s", cp.line.opc.mnemonic))
+	}
+
+	if cond != "" {
+		if rcp.cond, err = viceCondition(cond); err != nil {
+			return nil, err
+		}
+	}
+	return &rcp, nil
+}
+
+// writeMonCommands writes a script to be loaded in VICE with
+// `-moncommands {file}`, it defines the labels and sets all the
+// checkpoints found in the sources. Conditions are attached to
+// the checkpoints by number so the script expects to be loaded
+// before any other checkpoint is set in the monitor.
+func writeMonCommands(filename string, asm *assembly) error {
+
+	buffer := new(bytes.Buffer)
+
+	for _, sym := range sortedSymbols() {
+		fmt.Fprintf(buffer, "al C:%04x .%s\n", symbols[sym]&0xFFFF, sym)
+	}
+
+	for i, cp := range asm.checkpoints {
+		rcp, err := resolveCheckpoint(cp)
+		if err != nil {
+			return fmt.Errorf("%s:%d:%s", cp.line.loc.file, cp.line.loc.line, err.Error())
+		}
+
+		if !rcp.watch {
+			fmt.Fprintf(buffer, "break $%04x\n", rcp.start)
+		} else {
+			cmd := "watch"
+			if rcp.access != "" {
+				cmd += " " + rcp.access
+			}
+			if rcp.end != rcp.start {
+				fmt.Fprintf(buffer, "%s $%04x $%04x\n", cmd, rcp.start, rcp.end)
+			} else {
+				fmt.Fprintf(buffer, "%s $%04x\n", cmd, rcp.start)
+			}
+		}
+
+		// VICE numbers checkpoints starting from 1
+		if rcp.cond != "" {
+			fmt.Fprintf(buffer, "cond %d if %s\n", i+1, rcp.cond)
+		}
+	}
+
+	return ioutil.WriteFile(filename, buffer.Bytes(), 0644)
+}
+
+// viceCondition translates a condition written as a formula, like
+// `[= a 0]`, into VICE's monitor expression syntax (`A == $00`)
+func viceCondition(f string) (string, error) {
+	_, expr, err := parseFormulaSubExpr(f)
+	if err != nil {
+		return "", err
+	}
+	return viceExpression(expr)
+}
+
+var viceOperators = map[string]string{
+	"=":   "==",
+	"!=":  "!=",
+	"<>":  "!=",
+	"><":  "!=",
+	"<":   "<",
+	"<=":  "<=",
+	">":   ">",
+	">=":  ">=",
+	"&":   "&",
+	"AND": "&",
+	"|":   "|",
+	"OR":  "|",
+	"+":   "+",
+	"-":   "-",
+	"*":   "*",
+	"/":   "/",
+}
+
+var viceRegisters = map[string]bool{
+	"A":  true,
+	"X":  true,
+	"Y":  true,
+	"SP": true,
+	"PC": true,
+}
+
+func viceExpression(expr interface{}) (string, error) {
+	switch e := expr.(type) {
+	case []interface{}:
+		if len(e) < 3 {
+			return "", fmt.Errorf("Invalid condition %v", e)
+		}
+		operation, _ := e[0].(string)
+		op, found := viceOperators[strings.ToUpper(operation)]
+		if !found {
+			return "", fmt.Errorf("Operation '%v' is not supported in conditions", e[0])
+		}
+		terms := []string{}
+		for _, arg := range e[1:] {
+			term, err := viceExpression(arg)
+			if err != nil {
+				return "", err
+			}
+			if _, nested := arg.([]interface{}); nested {
+				term = "(" + term + ")"
+			}
+			terms = append(terms, term)
+		}
+		return strings.Join(terms, fmt.Sprintf(" %s ", op)), nil
+	case string:
+		if viceRegisters[strings.ToUpper(e)] {
+			return strings.ToUpper(e), nil
+		}
+		v, err := lookupSymbol(e)
+		if err != nil {
+			return "", err
+		}
+		return viceValue(v), nil
+	case int:
+		return viceValue(e), nil
+	case float64:
+		return viceValue(int(e)), nil
+	default:
+		return "", fmt.Errorf("Invalid term %v in condition", e)
+	}
+}
+
+func viceValue(v int) string {
+	if v <= 0xFF {
+		return fmt.Sprintf("$%02x", v)
+	}
+	return fmt.Sprintf("$%04x", v)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestViceCondition(t *testing.T) {
+	tests := []struct {
+		input  string
+		result string
+	}{{
+		`[= a 0]`, `A == $00`,
+	}, {
+		`[!= x $d020]`, `X != $d020`,
+	}, {
+		`[AND [= a 0] [>= y 10]]`, `(A == $00) & (Y >= $0a)`,
+	}, {
+		`[< sp [+ 1 $f0]]`, `SP < ($01 + $f0)`,
+	}}
+
+	for _, test := range tests {
+		r, err := viceCondition(test.input)
+		if err != nil {
+			t.Errorf("failed on input %s with %s", test.input, err.Error())
+		} else if r != test.result {
+			t.Errorf("%s: expected %s but got %s", test.input, test.result, r)
+		}
+	}
+}
+
+func TestWriteMonCommands(t *testing.T) {
+	defer resetSymbols()
+
+	var tests = []struct {
+		lines    []string
+		expected []string
+	}{
+		{
+			[]string{"\t.org $c000", "main:\tlda #0", "\t.break", "\trts"},
+			[]string{"al C:c000 .main", "break $c002"},
+		},
+		// conditions go to their checkpoint by number, counting
+		// the ones without a condition too
+		{
+			[]string{
+				"\t.org $c000",
+				"frame = $d020",
+				"\t.break",
+				"loop:\tinx",
+				"\t.break if [= x 8]",
+				"\t.watch store frame",
+				"\t.watch load $0400 $07e7 if [AND [= a 0] [>= y 10]]",
+				"\t.watch $fb",
+				"\tjmp loop",
+			},
+			[]string{
+				"al C:c000 .loop",
+				"al C:d020 .frame",
+				"break $c000",
+				"break $c001",
+				"cond 2 if X == $08",
+				"watch store $d020",
+				"watch load $0400 $07e7",
+				"cond 4 if (A == $00) & (Y >= $0a)",
+				"watch $00fb",
+			},
+		},
+	}
+
+	for i, test := range tests {
+		asm, err := assembleLines(t, test.lines)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		mon := filepath.Join(t.TempDir(), "main.mon")
+		if err := writeMonCommands(mon, asm); err != nil {
+			t.Fatal(err.Error())
+		}
+		actual, _ := ioutil.ReadFile(mon)
+		if expected := strings.Join(test.expected, "\n") + "\n"; string(actual) != expected {
+			t.Errorf("test %d: expected\n%s\nbut got\n%s", i, expected, actual)
+		}
+	}
+}
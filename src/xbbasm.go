@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
 // symbols table
@@ -14,13 +16,79 @@ func init() {
 	resetSymbols()
 }
 
+// stringList is a flag that can be given multiple times
+type stringList []string
+
+func (sl *stringList) String() string {
+	return strings.Join(*sl, ",")
+}
+
+func (sl *stringList) Set(v string) error {
+	*sl = append(*sl, v)
+	return nil
+}
+
+// subcommands, like `xbbasm disasm file.prg`
+var subcommands = map[string]func(args []string){
+	"disasm": disasmMain,
+	"run":    runMain,
+	"test":   testMain,
+}
+
 func main() {
 
 	// input and output filenames
 	var input string
 	var output *string
+	var debugInfo *string
+	var monCommands *string
+	var release *bool
+	var format *string
+	var crtType *string
+	var crtName *string
+	var d64 *string
+	var d64Name *string
+	var d64ID *string
+	var d64File *string
+	var d64Add stringList
+	var t64 *string
+	var tap *string
+	var tapeName *string
+	var opts outputOptions
+
+	// subcommands
+	if len(os.Args) > 1 {
+		if cmd, found := subcommands[os.Args[1]]; found {
+			cmd(os.Args[2:])
+			return
+		}
+	}
 
 	output = flag.String("out", "a.prg", "output filename")
+	format = flag.String("format", "prg", "output format: prg, raw, ihex, srec, crt or psid")
+	crtType = flag.String("crttype", "normal8k", "cartridge type: normal8k, normal16k, ultimax, ocean or easyflash")
+	crtName = flag.String("crtname", "xbbasm", "cartridge name in the CRT header")
+	debugInfo = flag.String("dbg", "", "write source level debug info (KickAssembler .dbg format) to file")
+	monCommands = flag.String("moncommands", "", "write labels and checkpoints as a VICE monitor commands file")
+	release = flag.Bool("release", false, "release build, strips all debugging checkpoints")
+	d64 = flag.String("d64", "", "also write the program into a new D64 disk image")
+	d64Name = flag.String("d64name", "xbbasm", "disk name for the D64 image")
+	d64ID = flag.String("d64id", "00", "disk ID for the D64 image")
+	d64File = flag.String("d64file", "", "name of the program in the D64 image (default: input file name)")
+	flag.Var(&d64Add, "d64add", "add a file to the D64 image as `file[=NAME]`, can be repeated")
+	t64 = flag.String("t64", "", "also write the program into a T64 tape image")
+	tap = flag.String("tap", "", "also write the program as a TAP tape recording")
+	tapeName = flag.String("tapename", "", "name of the program in the tape images (default: input file name)")
+	flag.StringVar(&opts.sidInit, "sidinit", "init", "label or address of the init routine in the PSID header")
+	flag.StringVar(&opts.sidPlay, "sidplay", "play", "label or address of the play routine in the PSID header (0 if the tune sets its own interrupt)")
+	flag.IntVar(&opts.sidSongs, "sidsongs", 1, "number of songs in the PSID header")
+	flag.IntVar(&opts.sidStartSong, "sidstart", 1, "song played first in the PSID header")
+	flag.StringVar(&opts.sidTitle, "sidtitle", "", "title in the PSID header")
+	flag.StringVar(&opts.sidAuthor, "sidauthor", "", "author in the PSID header")
+	flag.StringVar(&opts.sidReleased, "sidreleased", "", "release (year and group) in the PSID header")
+	flag.StringVar(&opts.sidSpeed, "sidspeed", "vbi", "speed of the songs in the PSID header: vbi or cia")
+	flag.StringVar(&opts.sidClock, "sidclock", "unknown", "video standard in the PSID header: pal, ntsc, any or unknown")
+	flag.StringVar(&opts.sidModel, "sidmodel", "unknown", "SID model in the PSID header: 6581, 8580, any or unknown")
 	flag.Parse()
 
 	nonFlags := flag.Args()
@@ -30,6 +98,11 @@ func main() {
 		input = nonFlags[0]
 	}
 
+	writeOutput, formatOk := outputFormats[*format]
+	if !formatOk {
+		fail(fmt.Sprintf("unknown output format %s", *format))
+	}
+
 	// parse all files and tokenize
 	p := beginParser(input)
 	if p.fatal != nil {
@@ -42,12 +115,96 @@ func main() {
 	}
 
 	// assemble program
-	if program, err := assemble(p.output); err != nil {
+	asm, err := assemble(p.output)
+	if err != nil {
+		fail(err.Error())
+	}
+	printMessages(asm.messages)
+
+	opts.crtType = *crtType
+	opts.crtName = *crtName
+	if out, err := writeOutput(asm, opts); err != nil {
 		fail(err.Error())
-	} else if err := ioutil.WriteFile(*output, program, 0644); err != nil {
+	} else if err := ioutil.WriteFile(*output, out, 0644); err != nil {
 		fail(err.Error())
 	} else {
-		fmt.Println(fmt.Sprintf("%d bytes written to %s", len(program), *output))
+		fmt.Println(fmt.Sprintf("%d bytes written to %s", len(out), *output))
+	}
+
+	progName := strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+
+	// disk image
+	if *d64 != "" {
+		if asm.program == nil {
+			fail(errBanked.Error())
+		}
+		if *d64File == "" {
+			*d64File = progName
+		}
+		files := asm.diskFiles
+		for _, f := range d64Add {
+			file := strings.SplitN(f, "=", 2)
+			if len(file) == 1 {
+				file = append(file, strings.TrimSuffix(filepath.Base(f), filepath.Ext(f)))
+			}
+			files = append(files, diskFile{path: file[0], name: file[1]})
+		}
+		if err := writeD64(*d64, *d64Name, *d64ID, *d64File, asm.program, files); err != nil {
+			fail(err.Error())
+		}
+		fmt.Println(fmt.Sprintf("disk image written to %s", *d64))
+	}
+
+	// tape images
+	if *t64 != "" || *tap != "" {
+		if asm.program == nil {
+			fail(errBanked.Error())
+		}
+		if *tapeName == "" {
+			*tapeName = progName
+		}
+	}
+	if *t64 != "" {
+		image, err := t64Image(*tapeName, asm.program)
+		if err != nil {
+			fail(err.Error())
+		}
+		if err := ioutil.WriteFile(*t64, image, 0644); err != nil {
+			fail(err.Error())
+		}
+		fmt.Println(fmt.Sprintf("tape image written to %s", *t64))
+	}
+	if *tap != "" {
+		image, err := tapImage(*tapeName, asm.program)
+		if err != nil {
+			fail(err.Error())
+		}
+		if err := ioutil.WriteFile(*tap, image, 0644); err != nil {
+			fail(err.Error())
+		}
+		fmt.Println(fmt.Sprintf("tape recording written to %s", *tap))
+	}
+
+	// checkpoints never change the program's
+	// bytes so they can be safely dropped here
+	if *release {
+		asm.checkpoints = nil
+	}
+
+	// debug info for source level debuggers
+	if *debugInfo != "" {
+		if err := writeDebugInfo(*debugInfo, asm); err != nil {
+			fail(err.Error())
+		}
+		fmt.Println(fmt.Sprintf("debug info written to %s", *debugInfo))
+	}
+
+	// monitor commands for VICE
+	if *monCommands != "" {
+		if err := writeMonCommands(*monCommands, asm); err != nil {
+			fail(err.Error())
+		}
+		fmt.Println(fmt.Sprintf("monitor commands written to %s", *monCommands))
 	}
 
 	return
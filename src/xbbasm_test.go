@@ -3,7 +3,10 @@ package main
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -45,20 +48,21 @@ func TestEverything(t *testing.T) {
 
 		p := beginParser(test.input)
 		if p.fatal != nil {
-			t.Errorf(fmt.Sprintf("%s: %s", test.input, p.fatal))
+			t.Errorf("%s: %s", test.input, p.fatal)
 			continue
 		} else if len(p.errors) > 0 {
 			for _, e := range p.errors {
-				t.Errorf(fmt.Sprintf("%s: %s", test.input, e.Error()))
+				t.Errorf("%s: %s", test.input, e.Error())
 			}
 			continue
 		}
 
-		program, err := assemble(p.output)
+		asm, err := assemble(p.output)
 		if err != nil {
 			t.Errorf("%s: %s", test.input, err.Error())
 			continue
 		}
+		program := asm.program
 
 		expected, err := readBinaryFile(test.output)
 		if err != nil {
@@ -120,3 +124,36 @@ func readBinaryFile(filename string) (data []byte, binErr error) {
 	}
 	return data, binErr
 }
+
+// assembleSource parses and assembles a file with the symbols
+// reset, returning the first error of the parser or the assembler
+func assembleSource(t *testing.T, filename string) (*assembly, error) {
+	resetSymbols()
+	p := beginParser(filename)
+	if p.fatal != nil {
+		t.Fatal(p.fatal.Error())
+	}
+	if len(p.errors) > 0 {
+		return nil, p.errors[0]
+	}
+	return assemble(p.output)
+}
+
+// assembleLines assembles the lines as a file of their own, errors
+// start with its path and then the line number, like ":2:"
+func assembleLines(t *testing.T, lines []string) (*assembly, error) {
+	filename := filepath.Join(t.TempDir(), "test.asm")
+	if err := ioutil.WriteFile(filename, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	return assembleSource(t, filename)
+}
+
+// assembleTestFile assembles a file that must have no errors
+func assembleTestFile(t *testing.T, filename string) *assembly {
+	asm, err := assembleSource(t, filename)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return asm
+}